@@ -19,27 +19,57 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/grafeas/kritis/cmd/kritis/version"
 	"github.com/grafeas/kritis/pkg/kritis/admission"
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/audit"
+	"github.com/grafeas/kritis/pkg/kritis/breakglass"
+	"github.com/grafeas/kritis/pkg/kritis/certs"
+	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
 	"github.com/grafeas/kritis/pkg/kritis/cron"
+	"github.com/grafeas/kritis/pkg/kritis/health"
 	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
 	"github.com/grafeas/kritis/pkg/kritis/metadata/containeranalysis"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
 	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
 )
 
 var (
-	tlsCertFile  string
-	tlsKeyFile   string
-	cronInterval string
-	showVersion  bool
+	addr            string
+	tlsCertFile     string
+	tlsKeyFile      string
+	clientCAFile    string
+	tlsReload       time.Duration
+	cronInterval    string
+	cveWarning      time.Duration
+	showVersion     bool
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+
+	breakglassUsers  string
+	breakglassGroups string
+	failurePolicy    string
+	reviewTimeout    time.Duration
+
+	metadataCacheTTL      time.Duration
+	metadataCacheStaleTTL time.Duration
+	metadataCacheSize     int
+
+	auditLog string
 )
 
 const (
@@ -47,11 +77,25 @@ const (
 )
 
 func main() {
+	flag.StringVar(&addr, "addr", Addr, "Address the server listens on.")
 	flag.StringVar(&tlsCertFile, "tls-cert-file", "/var/tls/tls.crt", "TLS certificate file.")
 	flag.StringVar(&tlsKeyFile, "tls-key-file", "/var/tls/tls.key", "TLS key file.")
+	flag.DurationVar(&tlsReload, "tls-reload-interval", time.Minute, "Interval at which the TLS certificate and key files are checked for changes, and reloaded.")
+	flag.StringVar(&clientCAFile, "client-ca-file", "", "CA bundle to verify client certificates of admission requests with. If set, admission requests without a verified client certificate are rejected.")
 	flag.BoolVar(&showVersion, "version", false, "kritis-server version")
 	flag.Set("logtostderr", "true")
 	flag.StringVar(&cronInterval, "cron-interval", "1h", "Cron Job time interval as Duration e.g. 1h, 2s")
+	flag.DurationVar(&cveWarning, "cve-whitelist-expiry-warning", cron.DefaultWhitelistExpiryWarning, "How long before a whitelisted CVE or package exception expires the Cron Job starts warning about it.")
+	flag.StringVar(&breakglassUsers, "breakglass-users", "", "Comma separated users allowed to use the breakglass annotation. Anyone may use it if neither users nor groups are set.")
+	flag.StringVar(&breakglassGroups, "breakglass-groups", "", "Comma separated groups allowed to use the breakglass annotation.")
+	flag.StringVar(&failurePolicy, "failure-policy", string(v1beta1.FailurePolicyClosed), "Whether to admit (open) or deny (closed) images which can't be reviewed because of a metadata backend error. Image security policies can override it.")
+	flag.DurationVar(&reviewTimeout, "review-timeout", 8*time.Second, "Deadline for metadata backend lookups of an admission request. It should be lower than the timeout of the webhook.")
+	flag.DurationVar(&metadataCacheTTL, "metadata-cache-ttl", time.Minute, "How long vulnerabilities and attestations of an image digest are cached. Set to 0 to disable the cache.")
+	flag.DurationVar(&metadataCacheStaleTTL, "metadata-cache-stale-ttl", 10*time.Minute, "How long after --metadata-cache-ttl cached lookups are still served, while they are refreshed in the background.")
+	flag.IntVar(&metadataCacheSize, "metadata-cache-size", 10000, "Maximum number of lookups cached.")
+	flag.StringVar(&auditLog, "audit-log", "", "Comma separated sinks of the audit log of admission decisions: stdout, file:<path> or an http(s) URL. The audit log is disabled if empty.")
+	flag.DurationVar(&shutdownDelay, "shutdown-delay", 5*time.Second, "Time to keep serving after SIGTERM while not ready, so that the server is taken out of its service endpoints.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 20*time.Second, "Time to wait for in-flight requests to complete when shutting down.")
 	flag.Parse()
 
 	if showVersion {
@@ -59,43 +103,199 @@ func main() {
 		os.Exit(0)
 	}
 
+	switch v1beta1.FailurePolicy(failurePolicy) {
+	case v1beta1.FailurePolicyOpen, v1beta1.FailurePolicyClosed:
+	default:
+		glog.Fatalf("invalid --failure-policy %q, must be %s or %s", failurePolicy, v1beta1.FailurePolicyOpen, v1beta1.FailurePolicyClosed)
+	}
+	backend, err := containeranalysis.NewContainerAnalysisClient()
+	if err != nil {
+		glog.Fatal(errors.Wrap(err, "creating metadata client"))
+	}
+	client := newMetadataClient(backend)
+	if err := securitypolicy.Start(); err != nil {
+		glog.Fatal(errors.Wrap(err, "starting image security policy caches"))
+	}
+	auditLogger, err := newAuditLogger()
+	if err != nil {
+		glog.Fatal(errors.Wrap(err, "creating audit log"))
+	}
+	admission.SetOptions(admission.Options{
+		BreakglassRequesters: breakglass.Requesters{
+			Users:  splitList(breakglassUsers),
+			Groups: splitList(breakglassGroups),
+		},
+		FailurePolicy:  v1beta1.FailurePolicy(failurePolicy),
+		ReviewTimeout:  reviewTimeout,
+		MetadataClient: client,
+		AuditLog:       auditLogger,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Kick off back ground cron job.
-	if err := StartCronJob(); err != nil {
+	if err := StartCronJob(ctx, client); err != nil {
 		glog.Fatal(errors.Wrap(err, "starting background job"))
 	}
 
 	// Start the Kritis Server.
 	glog.Info("Running the server")
-	http.HandleFunc("/", admission.AdmissionReviewHandler)
-	httpsServer := NewServer(Addr)
-	glog.Fatal(httpsServer.ListenAndServeTLS(tlsCertFile, tlsKeyFile))
+	checker := health.NewChecker(
+		// Neither check waits or calls an API, so that probes don't time out
+		health.Check{Name: "imagesecuritypolicies", Check: securitypolicy.Synced},
+		health.Check{Name: "metadata", Check: backend.Ready},
+	)
+	servingCert, err := certs.NewReloader(tlsCertFile, tlsKeyFile)
+	if err != nil {
+		glog.Fatal(errors.Wrap(err, "loading TLS certificate"))
+	}
+	go servingCert.Watch(ctx, tlsReload)
+	var clientCAs *x509.CertPool
+	if clientCAFile != "" {
+		if clientCAs, err = loadClientCAs(clientCAFile); err != nil {
+			glog.Fatal(errors.Wrap(err, "loading client CA bundle"))
+		}
+	}
+	http.HandleFunc("/", requireClientCert(clientCAs, admission.AdmissionReviewHandler))
+	http.HandleFunc("/mutate", requireClientCert(clientCAs, admission.MutatingAdmissionReviewHandler))
+	// CI pipelines authenticate to the check API with a bearer token instead of a client certificate
+	http.HandleFunc("/v1/check", admission.CheckHandler)
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/healthz", checker.Healthz)
+	http.HandleFunc("/readyz", checker.Readyz)
+	httpsServer := NewServer(addr, servingCert, clientCAs)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		sig := <-signals
+		glog.Infof("Received %s, shutting down", sig)
+		checker.ShutDown()
+		cancel()
+		time.Sleep(shutdownDelay)
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := httpsServer.Shutdown(shutdownCtx); err != nil {
+			glog.Errorf("error draining in-flight requests: %v", err)
+		}
+	}()
+	if err := httpsServer.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		glog.Fatal(err)
+	}
+	<-done
+	if auditLogger != nil {
+		auditLogger.Close()
+	}
+	glog.Info("Server stopped")
 }
 
-func NewServer(addr string) *http.Server {
+// NewServer returns the kritis server, serving the certificate of servingCert and
+// verifying client certificates against clientCAs if they are set
+func NewServer(addr string, servingCert *certs.Reloader, clientCAs *x509.CertPool) *http.Server {
+	clientAuth := tls.NoClientCert
+	if clientCAs != nil {
+		// Probes and metrics scrapers don't present a client certificate,
+		// so it's required by the admission handlers only.
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
 	return &http.Server{
 		Addr: addr,
 		TLSConfig: &tls.Config{
-			// TODO: Change this to tls.RequireAndVerifyClientCert
-			ClientAuth: tls.NoClientCert,
+			GetCertificate: servingCert.GetCertificate,
+			ClientAuth:     clientAuth,
+			ClientCAs:      clientCAs,
 		},
 	}
 }
 
-func StartCronJob() error {
+// loadClientCAs reads a PEM encoded CA bundle
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// requireClientCert rejects requests without a verified client certificate
+// when clientCAs are set
+func requireClientCert(clientCAs *x509.CertPool, h http.HandlerFunc) http.HandlerFunc {
+	if clientCAs == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			glog.Warningf("rejecting request from %s without a verified client certificate", r.RemoteAddr)
+			http.Error(w, "a verified client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// newMetadataClient returns the metadata client shared by the webhooks and the
+// cron job, caching its lookups unless --metadata-cache-ttl is 0
+func newMetadataClient(backend *containeranalysis.ContainerAnalysis) metadata.MetadataFetcher {
+	fetcher := metadata.Instrumented(*backend, containeranalysis.Backend)
+	if metadataCacheTTL <= 0 {
+		return fetcher
+	}
+	return metadata.Cached(fetcher, metadata.CacheOptions{
+		TTL:        metadataCacheTTL,
+		StaleTTL:   metadataCacheStaleTTL,
+		MaxEntries: metadataCacheSize,
+	})
+}
+
+// newAuditLogger returns the audit logger writing to the sinks of --audit-log,
+// or nil if there are none
+func newAuditLogger() (*audit.Logger, error) {
+	specs := splitList(auditLog)
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	var sinks []audit.Sink
+	for _, spec := range specs {
+		s, err := audit.NewSink(spec)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return audit.NewLogger(sinks...)
+}
+
+// StartCronJob starts the background cron job with client, until ctx is done
+func StartCronJob(ctx context.Context, client metadata.MetadataFetcher) error {
 	checkInterval, err := time.ParseDuration(cronInterval)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
 	ki, err := kubernetesutil.GetClientset()
 	if err != nil {
 		return err
 	}
 	kcs := ki.(*kubernetes.Clientset)
-	metadataClient, err := containeranalysis.NewContainerAnalysisClient()
-	if err != nil {
-		return err
-	}
-	go cron.Start(ctx, *cron.NewCronConfig(kcs, *metadataClient), checkInterval)
+	cfg := cron.NewCronConfig(kcs, client)
+	cfg.WhitelistExpiryWarning = cveWarning
+	go cron.Start(ctx, *cfg, checkInterval)
 	return nil
 }
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
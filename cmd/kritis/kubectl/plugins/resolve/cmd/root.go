@@ -104,7 +104,7 @@ func outputResults(substitutes map[string]string, writer io.Writer) error {
 func print(substitutes map[string]string, writer io.Writer) {
 	for file, contents := range substitutes {
 		fmt.Fprintln(writer, fmt.Sprintf("---%s---", file))
-		fmt.Fprintf(writer, contents)
+		fmt.Fprint(writer, contents)
 		fmt.Fprintln(writer)
 	}
 }
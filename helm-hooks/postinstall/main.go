@@ -30,12 +30,14 @@ var (
 	certificate           string
 	webhookName           string
 	deploymentWebhookName string
+	mutationWebhookName   string
 	serviceName           string
 )
 
 func init() {
 	flag.StringVar(&webhookName, "webhook-name", "", "The name of the validation webhook.")
 	flag.StringVar(&deploymentWebhookName, "deployment-webhook-name", "", "The name of the deployment validation webhook.")
+	flag.StringVar(&mutationWebhookName, "mutation-webhook-name", "", "The name of the mutation webhook that resolves tags to digests. Not created if empty.")
 	flag.StringVar(&serviceName, "service-name", "", "The name of the service for the webhook.")
 	flag.StringVar(&tlsSecretName, "tls-secret-name", "", "The name of the kritis tls secret.")
 	flag.Parse()
@@ -51,4 +53,7 @@ func main() {
 	getCaBundle()
 	createValidationWebhook()
 	createValidationDeploymentWebhook()
+	if mutationWebhookName != "" {
+		createMutationWebhook()
+	}
 }
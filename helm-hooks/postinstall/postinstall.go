@@ -66,12 +66,17 @@ func getCaBundle() {
 }
 
 func createValidationWebhook() {
-	webhookSpec := `apiVersion: admissionregistration.k8s.io/v1beta1
+	webhookSpec := `apiVersion: admissionregistration.k8s.io/v1
 kind: ValidatingWebhookConfiguration
 metadata:
   name: %s
 webhooks:
   - name: kritis-validation-hook.grafeas.io
+    admissionReviewVersions:
+      - v1
+      - v1beta1
+    # Events and audit records are skipped for dry run requests
+    sideEffects: NoneOnDryRun
     rules:
       - apiGroups:
           - ""
@@ -82,7 +87,10 @@ webhooks:
           - UPDATE
         resources:
           - pods
+          # kubectl debug adds ephemeral containers to running pods through this subresource
+          - pods/ephemeralcontainers
     failurePolicy: Fail
+    timeoutSeconds: 10
     clientConfig:
       caBundle: %s
       service:
@@ -97,12 +105,17 @@ webhooks:
 }
 
 func createValidationDeploymentWebhook() {
-	webhookSpec := `apiVersion: admissionregistration.k8s.io/v1beta1
+	webhookSpec := `apiVersion: admissionregistration.k8s.io/v1
 kind: ValidatingWebhookConfiguration
 metadata:
   name: %s
 webhooks:
   - name: kritis-validation-hook-deployments.grafeas.io
+    admissionReviewVersions:
+      - v1
+      - v1beta1
+    # Events and audit records are skipped for dry run requests
+    sideEffects: NoneOnDryRun
     rules:
       - apiGroups:
         - "*" # TODO(aaron-prindle) minimize this capture group
@@ -110,10 +123,19 @@ webhooks:
         - "*" # TODO(aaron-prindle) minimize this capture group
         operations:
           - CREATE
-          # - UPDATE # TODO(aaron-prindle) add back update when whitelist and helm do not collide
+          # Only images added or changed by an update are reviewed, so that helm
+          # and the garbage collector can update workloads with existing images
+          - UPDATE
         resources:
           - deployments
+          - replicasets
+          - statefulsets
+          - daemonsets
+          - replicationcontrollers
+          - jobs
+          - cronjobs
     failurePolicy: Fail
+    timeoutSeconds: 10
     clientConfig:
       caBundle: %s
       service:
@@ -125,3 +147,50 @@ webhooks:
 	webhookCmd.Stdin = bytes.NewReader([]byte(webhookSpec))
 	install.RunCommand(webhookCmd)
 }
+
+func createMutationWebhook() {
+	webhookSpec := `apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: %s
+webhooks:
+  - name: kritis-mutation-hook.grafeas.io
+    admissionReviewVersions:
+      - v1
+      - v1beta1
+    sideEffects: None
+    rules:
+      - apiGroups:
+          - "*"
+        apiVersions:
+          - "*"
+        operations:
+          - CREATE
+          # Only the images an update adds are pinned, e.g. by kubectl set image
+          - UPDATE
+        resources:
+          - pods
+          - pods/ephemeralcontainers
+          - deployments
+          - replicasets
+          - statefulsets
+          - daemonsets
+          - replicationcontrollers
+          - jobs
+          - cronjobs
+    # Images that can't be resolved are rejected by the validation webhook
+    failurePolicy: Ignore
+    # Resolving tags calls the registries
+    timeoutSeconds: 10
+    clientConfig:
+      caBundle: %s
+      service:
+        name: %s
+        namespace: %s
+        path: /mutate`
+	webhookSpec = fmt.Sprintf(webhookSpec, mutationWebhookName, certificate, serviceName, namespace)
+	fmt.Println(webhookSpec)
+	webhookCmd := exec.Command("kubectl", "apply", "-f", "-")
+	webhookCmd.Stdin = bytes.NewReader([]byte(webhookSpec))
+	install.RunCommand(webhookCmd)
+}
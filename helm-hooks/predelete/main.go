@@ -25,9 +25,11 @@ import (
 var (
 	namespace             = install.RetrieveNamespace()
 	tlsSecretName         string
+	clientSecretNames     string
 	csrName               string
 	webhookName           string
 	deploymentWebhookName string
+	mutationWebhookName   string
 	deleteCRD             bool
 	deleteCsr             bool
 )
@@ -35,17 +37,20 @@ var (
 func init() {
 	flag.StringVar(&webhookName, "webhook-name", "", "The name of the validation webhook.")
 	flag.StringVar(&deploymentWebhookName, "deployment-webhook-name", "", "The name of the validation webhook.")
+	flag.StringVar(&mutationWebhookName, "mutation-webhook-name", "", "The name of the mutation webhook.")
 	flag.StringVar(&tlsSecretName, "tls-secret-name", "", "The name of the kritis tls secret.")
+	flag.StringVar(&clientSecretNames, "client-auth-secret-names", "", "Comma separated names of the secrets for kube-apiserver client certificates.")
 	flag.StringVar(&csrName, "csr-name", "", "The name of the kritis csr.")
 	flag.BoolVar(&deleteCsr, "delete-csr", true, "Delete kritis csr")
 	flag.BoolVar(&deleteCRD, "delete-crd", true, "Delete kritis CRDs")
 	flag.Parse()
 }
 
-// The kritis predelete hook is responsible for deleting the webhook, TLS secret and CSR
+// The kritis predelete hook is responsible for deleting the webhook, TLS and client certificate secrets and CSR
 func main() {
 	deleteWebhooks()
 	deleteTLSSecret()
+	deleteClientAuthSecrets()
 	if deleteCsr {
 		deleteCSR()
 	}
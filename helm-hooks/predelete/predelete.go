@@ -19,6 +19,7 @@ package main
 import (
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/grafeas/kritis/pkg/kritis/install"
 	"github.com/sirupsen/logrus"
@@ -27,12 +28,23 @@ import (
 func deleteWebhooks() {
 	deleteObject("validatingwebhookconfiguration", webhookName)
 	deleteObject("validatingwebhookconfiguration", deploymentWebhookName)
+	if mutationWebhookName != "" {
+		deleteObject("mutatingwebhookconfiguration", mutationWebhookName)
+	}
 }
 
 func deleteTLSSecret() {
 	deleteObject("secret", tlsSecretName)
 }
 
+func deleteClientAuthSecrets() {
+	for _, name := range strings.Split(clientSecretNames, ",") {
+		if name != "" {
+			deleteObject("secret", name)
+		}
+	}
+}
+
 func deleteCSR() {
 	deleteObject("csr", csrName)
 }
@@ -40,6 +52,7 @@ func deleteCSR() {
 func deleteCRDs() {
 	deleteObject("crd", "attestationauthorities.kritis.grafeas.io")
 	deleteObject("crd", "imagesecuritypolicies.kritis.grafeas.io")
+	deleteObject("crd", "clusterimagesecuritypolicies.kritis.grafeas.io")
 }
 
 func deleteObject(object, name string) {
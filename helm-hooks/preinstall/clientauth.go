@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"text/template"
+
+	"github.com/grafeas/kritis/pkg/kritis/install"
+	"github.com/sirupsen/logrus"
+)
+
+// apiserverConfigDir is where the apiserver admission configuration is expected
+// to be installed on the control plane
+const apiserverConfigDir = "/etc/kubernetes/kritis"
+
+type APIServerConfig struct {
+	ConfigDir         string
+	Namespace         string
+	ServiceNames      []string
+	ClientCertificate string
+	ClientKey         string
+}
+
+// createClientAuth creates a CA for client certificates of the kube-apiserver,
+// stores it in the client CA secret for kritis-server and stores the apiserver
+// admission configuration presenting a certificate signed by it in the
+// apiserver config secret.
+func createClientAuth() {
+	caCmd := exec.Command("cfssl", "genkey", "-initca", "-")
+	caCmd.Stdin = bytes.NewReader([]byte(`{
+"CN": "kritis client CA",
+"key": {
+	"algo": "ecdsa",
+	"size": 256
+}
+}`))
+	output := install.RunCommand(caCmd)
+	caJSONCmd := exec.Command("cfssljson", "-bare", "ca")
+	caJSONCmd.Stdin = bytes.NewReader(output)
+	install.RunCommand(caJSONCmd)
+
+	clientCmd := exec.Command("cfssl", "gencert", "-ca=ca.pem", "-ca-key=ca-key.pem", "-")
+	clientCmd.Stdin = bytes.NewReader([]byte(`{
+"CN": "kube-apiserver",
+"key": {
+	"algo": "ecdsa",
+	"size": 256
+}
+}`))
+	output = install.RunCommand(clientCmd)
+	clientJSONCmd := exec.Command("cfssljson", "-bare", "client")
+	clientJSONCmd.Stdin = bytes.NewReader(output)
+	install.RunCommand(clientJSONCmd)
+
+	caSecretCmd := exec.Command("kubectl", "create", "secret", "generic", clientCASecretName, "--from-file=ca.crt=ca.pem", "--namespace", namespace)
+	install.RunCommand(caSecretCmd)
+
+	createAPIServerConfig()
+	configSecretCmd := exec.Command("kubectl", "create", "secret", "generic", apiserverConfigSecretName, "--from-file=admission-config.yaml", "--from-file=kubeconfig.yaml", "--namespace", namespace)
+	install.RunCommand(configSecretCmd)
+}
+
+// createAPIServerConfig writes the AdmissionConfiguration for the kube-apiserver
+// and the kubeconfig it references, which holds the client certificate for the
+// kritis services.
+func createAPIServerConfig() {
+	config := APIServerConfig{
+		ConfigDir:         apiserverConfigDir,
+		Namespace:         namespace,
+		ServiceNames:      []string{serviceName, serviceNameDeployments},
+		ClientCertificate: readBase64("client.pem"),
+		ClientKey:         readBase64("client-key.pem"),
+	}
+	executeTemplate("admission-config.yaml", `apiVersion: apiserver.k8s.io/v1alpha1
+kind: AdmissionConfiguration
+plugins:
+- name: ValidatingAdmissionWebhook
+  configuration:
+    apiVersion: apiserver.config.k8s.io/v1alpha1
+    kind: WebhookAdmission
+    kubeConfigFile: {{ .ConfigDir }}/kubeconfig.yaml
+- name: MutatingAdmissionWebhook
+  configuration:
+    apiVersion: apiserver.config.k8s.io/v1alpha1
+    kind: WebhookAdmission
+    kubeConfigFile: {{ .ConfigDir }}/kubeconfig.yaml
+`, config)
+	executeTemplate("kubeconfig.yaml", `apiVersion: v1
+kind: Config
+users:
+{{- range .ServiceNames }}
+- name: {{ . }}.{{ $.Namespace }}.svc
+  user:
+    client-certificate-data: {{ $.ClientCertificate }}
+    client-key-data: {{ $.ClientKey }}
+{{- end }}
+`, config)
+}
+
+func executeTemplate(file, text string, data interface{}) {
+	tmpl, err := template.New(file).Parse(text)
+	if err != nil {
+		logrus.Fatalf("error creating template for %s: %v", file, err)
+	}
+	var tpl bytes.Buffer
+	if err := tmpl.Execute(&tpl, data); err != nil {
+		logrus.Fatalf("error parsing template for %s: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, tpl.Bytes(), 0600); err != nil {
+		logrus.Fatalf("unable to write %s: %v", file, err)
+	}
+	fmt.Println(file)
+}
+
+func readBase64(file string) string {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		logrus.Fatalf("error trying to read contents of %s: %v", file, err)
+	}
+	return base64.StdEncoding.EncodeToString(contents)
+}
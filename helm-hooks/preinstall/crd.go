@@ -41,4 +41,17 @@ spec:
         kind: ImageSecurityPolicy
         plural: imagesecuritypolicies
         scope: Namespaced`
+
+	clusterImageSecurityPolicyCRD = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+    name: clusterimagesecuritypolicies.kritis.grafeas.io
+spec:
+    group: kritis.grafeas.io
+    version: v1beta1
+    scope: Cluster
+    names:
+        plural: clusterimagesecuritypolicies
+        singular: clusterimagesecuritypolicy
+        kind: ClusterImageSecurityPolicy`
 )
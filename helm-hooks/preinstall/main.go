@@ -32,6 +32,9 @@ var (
 	installCRD             bool
 	serviceName            string
 	serviceNameDeployments string
+
+	clientCASecretName        string
+	apiserverConfigSecretName string
 )
 
 func init() {
@@ -40,6 +43,8 @@ func init() {
 	flag.BoolVar(&createNewCSR, "create-new-csr", true, "Set to false in order to only create a new CSR if one is not present.")
 	flag.StringVar(&serviceName, "kritis-service-name", "", "The name of the kritis service for pods.")
 	flag.StringVar(&serviceNameDeployments, "kritis-service-name-deployments", "", "The name of the kritis service for deployments.")
+	flag.StringVar(&clientCASecretName, "client-ca-secret-name", "", "The name of the secret for the CA of kube-apiserver client certificates. Client certificates aren't set up if empty.")
+	flag.StringVar(&apiserverConfigSecretName, "apiserver-config-secret-name", "", "The name of the secret for the kube-apiserver admission configuration presenting client certificates.")
 	flag.Parse()
 }
 
@@ -60,6 +65,10 @@ func main() {
 	}
 	// Create the TLS secret
 	createTLSSecret()
+	if clientCASecretName != "" {
+		// Create the CA and configuration for kube-apiserver client certificates
+		createClientAuth()
+	}
 	installCRDs()
 
 }
@@ -58,6 +58,17 @@ func deleteExistingObjects() {
 		deleteSecretCmd := exec.Command("kubectl", "delete", "secret", tlsSecretName, "--namespace", namespace)
 		install.RunCommand(deleteSecretCmd)
 	}
+
+	for _, name := range []string{clientCASecretName, apiserverConfigSecretName} {
+		if name == "" {
+			continue
+		}
+		getCmd := exec.Command("kubectl", "get", "secret", name, "--namespace", namespace)
+		if _, err := getCmd.Output(); err == nil {
+			deleteCmd := exec.Command("kubectl", "delete", "secret", name, "--namespace", namespace)
+			install.RunCommand(deleteCmd)
+		}
+	}
 }
 
 func createCertificates() {
@@ -199,4 +210,8 @@ func installCRDs() {
 	ispCommand := exec.Command("kubectl", "apply", "-f", "-")
 	ispCommand.Stdin = bytes.NewReader([]byte(imageSecurityPolicyCRD))
 	install.RunCommand(ispCommand)
+
+	cispCommand := exec.Command("kubectl", "apply", "-f", "-")
+	cispCommand.Stdin = bytes.NewReader([]byte(clusterImageSecurityPolicyCRD))
+	install.RunCommand(cispCommand)
 }
@@ -21,24 +21,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/grafeas/kritis/cmd/kritis/version"
 	"github.com/grafeas/kritis/pkg/kritis/admission/constants"
 	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
-	kritisconstants "github.com/grafeas/kritis/pkg/kritis/constants"
+	"github.com/grafeas/kritis/pkg/kritis/audit"
+	"github.com/grafeas/kritis/pkg/kritis/breakglass"
 	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
+	"github.com/grafeas/kritis/pkg/kritis/kubectl/plugins/resolve"
+	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
 	"github.com/grafeas/kritis/pkg/kritis/metadata/containeranalysis"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
 	"github.com/grafeas/kritis/pkg/kritis/pods"
 	"github.com/grafeas/kritis/pkg/kritis/review"
 	"github.com/grafeas/kritis/pkg/kritis/violation"
 	"k8s.io/api/admission/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type config struct {
@@ -46,6 +58,29 @@ type config struct {
 	retrieveDeployment         func(r *http.Request) (*appsv1.Deployment, v1beta1.AdmissionReview, error)
 	fetchMetadataClient        func() (metadata.MetadataFetcher, error)
 	fetchImageSecurityPolicies func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error)
+	fetchPullSecrets           func(namespace string, names []string) (authn.Keychain, error)
+	fetchPod                   func(namespace, name string) (*v1.Pod, error)
+	resolveImage               func(image string, keychain authn.Keychain) (string, error)
+	recordEvent                func(ref v1.ObjectReference, eventType, reason, message string) error
+	authenticate               func(token string) (authenticationv1.UserInfo, error)
+	authorize                  func(user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) error
+}
+
+// Options are the settings of the admission webhook
+type Options struct {
+	// BreakglassRequesters are the users and groups allowed to use the breakglass annotation
+	BreakglassRequesters breakglass.Requesters
+	// FailurePolicy is what happens to images which can't be reviewed because of a
+	// metadata backend error, unless a policy overrides it
+	FailurePolicy kritisv1beta1.FailurePolicy
+	// ReviewTimeout bounds the time spent querying the metadata backend for a request.
+	// It should leave room for the response within the timeout of the webhook.
+	ReviewTimeout time.Duration
+	// MetadataClient is the metadata client shared by every request, e.g. a cache.
+	// A client is created for each request if it's nil.
+	MetadataClient metadata.MetadataFetcher
+	// AuditLog records every decision of the validating webhook, if it's set
+	AuditLog *audit.Logger
 }
 
 var (
@@ -54,7 +89,17 @@ var (
 		retrievePod:                unmarshalPod,
 		retrieveDeployment:         unmarshalDeployment,
 		fetchMetadataClient:        metadataClient,
-		fetchImageSecurityPolicies: securitypolicy.ImageSecurityPolicies,
+		fetchImageSecurityPolicies: securitypolicy.EffectivePolicies,
+		fetchPullSecrets:           pullSecretKeychain,
+		fetchPod:                   getPod,
+		resolveImage:               resolve.ResolveTag,
+		recordEvent:                kubernetesutil.RecordEvent,
+		authenticate:               kubernetesutil.Authenticate,
+		authorize:                  kubernetesutil.Authorize,
+	}
+
+	options = Options{
+		FailurePolicy: kritisv1beta1.FailurePolicyClosed,
 	}
 
 	defaultViolationStrategy = &violation.LoggingStrategy{}
@@ -65,52 +110,175 @@ var (
 	codecs        = serializer.NewCodecFactory(runtimeScheme)
 )
 
-var handlers = map[string]func(*v1beta1.AdmissionReview, *v1beta1.AdmissionReview){
-	"Deployment": handleDeployment,
-	"Pod":        handlePod,
+// admissionResponse is a v1beta1.AdmissionResponse with the warnings added in
+// Kubernetes 1.19, which the vendored API types predate.
+type admissionResponse struct {
+	*v1beta1.AdmissionResponse
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// admissionReview is the AdmissionReview sent back to the API server
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Response        *admissionResponse `json:"response,omitempty"`
+	// record is the audit record of the decision, filled in as the request is reviewed
+	record audit.Record
+	// dryRun is set for dry run requests, which mustn't record events nor audit records
+	dryRun bool
+}
+
+// recordEvent records an event about the object referenced by ref, unless the request is a dry run
+func (ar *admissionReview) recordEvent(ref v1.ObjectReference, eventType, reason, message string) error {
+	if ar.dryRun {
+		return nil
+	}
+	return admissionConfig.recordEvent(ref, eventType, reason, message)
+}
+
+// newAdmissionReview returns a review which admits the request with the given uid
+func newAdmissionReview(apiVersion string, uid types.UID) *admissionReview {
+	return &admissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       constants.AdmissionReviewKind,
+		},
+		Response: &admissionResponse{
+			AdmissionResponse: &v1beta1.AdmissionResponse{
+				UID:     uid,
+				Allowed: true,
+				Result: &metav1.Status{
+					Status:  string(constants.SuccessStatus),
+					Message: constants.SuccessMessage,
+				},
+			},
+		},
+	}
+}
+
+var handlers = map[string]func(*v1beta1.AdmissionReview, *admissionReview){
+	"Deployment":            handleDeployment,
+	"Pod":                   handlePod,
+	"ReplicaSet":            handleReplicaSet,
+	"StatefulSet":           handleStatefulSet,
+	"DaemonSet":             handleDaemonSet,
+	"ReplicationController": handleReplicationController,
+	"Job":                   handleJob,
+	"CronJob":               handleCronJob,
+	"EphemeralContainers":   handleEphemeralContainers,
 }
 
-func handleDeployment(ar *v1beta1.AdmissionReview, admitResponse *v1beta1.AdmissionReview) {
+func handleDeployment(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
 	glog.Info("handling deployment...")
 	deployment := appsv1.Deployment{}
 	json.Unmarshal(ar.Request.Object.Raw, &deployment)
-	reviewDeployment(&deployment, admitResponse)
+	reviewDeployment(&deployment, ar.Request, admitResponse)
+}
+
+func handleReplicaSet(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling replicaset...")
+	rs := appsv1.ReplicaSet{}
+	json.Unmarshal(ar.Request.Object.Raw, &rs)
+	reviewPodTemplate(&rs.ObjectMeta, rs.Spec.Template, ar.Request, admitResponse)
+}
+
+func handleStatefulSet(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling statefulset...")
+	ss := appsv1.StatefulSet{}
+	json.Unmarshal(ar.Request.Object.Raw, &ss)
+	reviewPodTemplate(&ss.ObjectMeta, ss.Spec.Template, ar.Request, admitResponse)
+}
+
+func handleDaemonSet(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling daemonset...")
+	ds := appsv1.DaemonSet{}
+	json.Unmarshal(ar.Request.Object.Raw, &ds)
+	reviewPodTemplate(&ds.ObjectMeta, ds.Spec.Template, ar.Request, admitResponse)
+}
+
+func handleReplicationController(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling replicationcontroller...")
+	rc := v1.ReplicationController{}
+	json.Unmarshal(ar.Request.Object.Raw, &rc)
+	// Unlike the other workloads, the pod template of a ReplicationController is optional
+	if rc.Spec.Template == nil {
+		return
+	}
+	reviewPodTemplate(&rc.ObjectMeta, *rc.Spec.Template, ar.Request, admitResponse)
+}
+
+func handleJob(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling job...")
+	job := batchv1.Job{}
+	json.Unmarshal(ar.Request.Object.Raw, &job)
+	reviewPodTemplate(&job.ObjectMeta, job.Spec.Template, ar.Request, admitResponse)
+}
+
+func handleCronJob(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling cronjob...")
+	cj := batchv1beta1.CronJob{}
+	json.Unmarshal(ar.Request.Object.Raw, &cj)
+	reviewPodTemplate(&cj.ObjectMeta, cj.Spec.JobTemplate.Spec.Template, ar.Request, admitResponse)
 }
 
-func handlePod(ar *v1beta1.AdmissionReview, admitResponse *v1beta1.AdmissionReview) {
+func handlePod(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
 	glog.Info("handling pod...")
 	pod := v1.Pod{}
 	json.Unmarshal(ar.Request.Object.Raw, &pod)
-	reviewPod(&pod, admitResponse)
+	reviewPod(&pod, ar.Request, admitResponse)
+}
+
+// handleEphemeralContainers reviews the pods/ephemeralcontainers subresource of
+// Kubernetes 1.16 to 1.21. Later versions send a Pod, which handlePod reviews.
+func handleEphemeralContainers(ar *v1beta1.AdmissionReview, admitResponse *admissionReview) {
+	glog.Info("handling ephemeralcontainers...")
+	// The vendored API types predate the EphemeralContainers kind, whose metadata is the pod's
+	ec := struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}{}
+	json.Unmarshal(ar.Request.Object.Raw, &ec)
+	reviewPod(&v1.Pod{ObjectMeta: ec.ObjectMeta}, ar.Request, admitResponse)
 }
 
-func deserializeRequest(w http.ResponseWriter, r *http.Request) (v1beta1.AdmissionReview, error) {
+// deserializeRequest decodes an admission review, and whether its request is a dry run
+func deserializeRequest(r *http.Request) (v1beta1.AdmissionReview, bool, error) {
 	ar := v1beta1.AdmissionReview{}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return ar, err
+		return ar, false, err
 	}
 
 	deserializer := codecs.UniversalDeserializer()
 	if _, _, err := deserializer.Decode(body, nil, &ar); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-
-		payload, err := json.Marshal(&v1beta1.AdmissionResponse{
-			UID:     ar.Request.UID,
-			Allowed: false,
-			Result: &metav1.Status{
-				Status:  string(constants.FailureStatus),
-				Message: err.Error(),
-			},
-		})
-		if err != nil {
-			glog.Info(err)
-		}
-		w.Write(payload)
+		return ar, false, err
+	}
+	if ar.Request == nil {
+		return ar, false, fmt.Errorf("admission review has no request")
+	}
+	// The vendored AdmissionRequest predates its dryRun field
+	dryRun := struct {
+		Request struct {
+			DryRun *bool `json:"dryRun"`
+		} `json:"request"`
+	}{}
+	if err := json.Unmarshal(body, &dryRun); err != nil {
+		return ar, false, err
+	}
+	return ar, dryRun.Request.DryRun != nil && *dryRun.Request.DryRun, nil
+}
+
+// admissionReviewVersion returns the apiVersion the response has to be sent in.
+// admission.k8s.io/v1 and v1beta1 share the same wire format, so the request is
+// decoded into the v1beta1 types and the response is tagged with the request's apiVersion.
+func admissionReviewVersion(ar v1beta1.AdmissionReview) (string, error) {
+	switch ar.APIVersion {
+	case "":
+		// Requests without TypeMeta are only sent by v1beta1 clients
+		return constants.AdmissionV1beta1, nil
+	case constants.AdmissionV1, constants.AdmissionV1beta1:
+		return ar.APIVersion, nil
 	}
-	return ar, nil
+	return "", fmt.Errorf("unsupported admission review version %s", ar.APIVersion)
 }
 
 func AdmissionReviewHandler(w http.ResponseWriter, r *http.Request) {
@@ -118,29 +286,29 @@ func AdmissionReviewHandler(w http.ResponseWriter, r *http.Request) {
 		version.Version,
 		version.Commit,
 	)
-	ar, err := deserializeRequest(w, r)
+	ar, dryRun, err := deserializeRequest(r)
 	if err != nil {
 		glog.Errorf("Error reading body: %v", err)
 		http.Error(w, "can't read body", http.StatusBadRequest)
 		return
 	}
-
-	admitResponse := &v1beta1.AdmissionReview{
-		Response: &v1beta1.AdmissionResponse{
-			UID:     ar.Request.UID,
-			Allowed: true,
-			Result: &metav1.Status{
-				Status:  string(constants.SuccessStatus),
-				Message: constants.SuccessMessage,
-			},
-		},
+	apiVersion, err := admissionReviewVersion(ar)
+	if err != nil {
+		glog.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	admitResponse := newAdmissionReview(apiVersion, ar.Request.UID)
+	admitResponse.record = newAuditRecord(ar.Request)
+	admitResponse.dryRun = dryRun
+
 	for k8sType, handler := range handlers {
 		if ar.Request.Kind.Kind == k8sType {
 			handler(&ar, admitResponse)
 		}
 	}
+	auditDecision(admitResponse)
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
@@ -151,20 +319,63 @@ func AdmissionReviewHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(payload)
 }
 
-func reviewDeployment(deployment *appsv1.Deployment, ar *v1beta1.AdmissionReview) {
-	if checkBreakglass(&deployment.ObjectMeta) {
-		glog.Infof("found breakglass annotation for %s, returning successful status", deployment.Name)
+func reviewDeployment(deployment *appsv1.Deployment, req *v1beta1.AdmissionRequest, ar *admissionReview) {
+	reviewPodTemplate(&deployment.ObjectMeta, deployment.Spec.Template, req, ar)
+}
+
+// reviewPodTemplate reviews the images in the pod template of a workload
+// The breakglass annotation is read from the workload itself
+func reviewPodTemplate(meta *metav1.ObjectMeta, template v1.PodTemplateSpec, req *v1beta1.AdmissionRequest, ar *admissionReview) {
+	pod := v1.Pod{
+		ObjectMeta: template.ObjectMeta,
+		Spec:       template.Spec,
+	}
+	// Controllers copy the breakglass of the template to the objects they create
+	if err := checkTemplateBreakglass(template.ObjectMeta, req); err != nil {
+		glog.Warningf("denying %s %s/%s: %v", req.Kind.Kind, req.Namespace, req.Name, err)
+		createDeniedResponse(ar, err.Error())
+		metrics.RecordAdmissionDecision(req.Kind.Kind, req.Namespace, "", metrics.OutcomeDenied)
+		return
+	}
+	images := changedImages(pods.Images(pod), req)
+	if len(images) == 0 {
+		glog.Infof("no images changed in %s %s/%s, returning successful status", req.Kind.Kind, req.Namespace, req.Name)
+		return
+	}
+	if checkBreakglass(meta, images, req, ar) {
 		return
 	}
-	for _, c := range deployment.Spec.Template.Spec.Containers {
-		reviewImages([]string{c.Image}, deployment.Namespace, nil, ar)
+	ref := objectReference(meta, req)
+	pod.Namespace = ref.Namespace
+	reviewImages(images, &pod, nil, ref, ar)
+}
+
+// changedImages returns the images of an UPDATE request which weren't already in
+// the previous object, so that updates leaving images untouched aren't reviewed again.
+// Every image is returned for other operations.
+func changedImages(images []string, req *v1beta1.AdmissionRequest) []string {
+	if req.Operation != v1beta1.Update || len(req.OldObject.Raw) == 0 {
+		return images
+	}
+	old, err := objectImages(req.Kind.Kind, req.OldObject.Raw)
+	if err != nil {
+		glog.Warningf("error decoding previous %s %s/%s, reviewing all its images: %v", req.Kind.Kind, req.Namespace, req.Name, err)
+		return images
+	}
+	previous := map[string]bool{}
+	for _, image := range old {
+		previous[image] = true
 	}
-	for _, c := range deployment.Spec.Template.Spec.InitContainers {
-		reviewImages([]string{c.Image}, deployment.Namespace, nil, ar)
+	changed := []string{}
+	for _, image := range images {
+		if !previous[image] {
+			changed = append(changed, image)
+		}
 	}
+	return changed
 }
 
-func createDeniedResponse(ar *v1beta1.AdmissionReview, message string) {
+func createDeniedResponse(ar *admissionReview, message string) {
 	ar.Response.Allowed = false
 	ar.Response.Result = &metav1.Status{
 		Status:  string(constants.FailureStatus),
@@ -172,37 +383,267 @@ func createDeniedResponse(ar *v1beta1.AdmissionReview, message string) {
 	}
 }
 
-func reviewImages(images []string, ns string, pod *v1.Pod, ar *v1beta1.AdmissionReview) {
+// reviewImages reviews the images of the object referenced by ref against the
+// image security policies of its namespace, and the cluster image security policies selecting it.
+// ephemeral are the ephemeral containers of pod, which v1.Pod predates.
+func reviewImages(images []string, pod *v1.Pod, ephemeral []v1.Container, ref v1.ObjectReference, ar *admissionReview) {
+	ns := ref.Namespace
+	ar.record.Namespace, ar.record.Name = ns, ref.Name
+	for _, image := range images {
+		ar.record.Images = append(ar.record.Images, audit.NewImage(image))
+	}
 	isps, err := admissionConfig.fetchImageSecurityPolicies(ns)
 	if err != nil {
 		errMsg := fmt.Sprintf("error getting image security policies: %v", err)
-		glog.Errorf(errMsg)
+		glog.Error(errMsg)
 		createDeniedResponse(ar, errMsg)
+		metrics.RecordAdmissionDecision(ref.Kind, ns, "", metrics.OutcomeError)
 		return
 	}
 	client, err := admissionConfig.fetchMetadataClient()
 	if err != nil {
-		errMsg := fmt.Sprintf("error getting metadata client: %v", err)
-		glog.Errorf(errMsg)
-		createDeniedResponse(ar, errMsg)
-		return
+		// Policies decide whether to fail open or closed on the lookups of this client
+		glog.Errorf("error getting metadata client: %v", err)
+		client = metadata.Unavailable(fmt.Errorf("error getting metadata client: %v", err))
 	}
-	r := review.New(client, defaultViolationStrategy, securitypolicy.ValidateImageSecurityPolicy)
+	if options.ReviewTimeout > 0 {
+		client = metadata.WithDeadline(client, time.Now().Add(options.ReviewTimeout))
+	}
+	r := review.New(client, defaultViolationStrategy, securitypolicy.ValidateImageSecurityPolicy).
+		WithFailurePolicy(options.FailurePolicy).WithEphemeralContainers(ephemeral)
 
 	glog.Infof("Got isps %v", isps)
-	if err := r.Review(images, isps, pod); err != nil {
-		createDeniedResponse(ar, err.Error())
+	err = r.Review(images, isps, pod)
+	verr, ok := err.(*review.ViolationError)
+	if !ok {
+		if err != nil {
+			createDeniedResponse(ar, err.Error())
+			metrics.RecordAdmissionDecision(ref.Kind, ns, "", metrics.OutcomeError)
+			return
+		}
+		verr = &review.ViolationError{}
+	}
+	recordDecisions(ref, isps, verr)
+	auditReview(&ar.record, isps, verr)
+	for _, v := range verr.WithAction(kritisv1beta1.EnforcementActionWarn) {
+		ar.Response.Warnings = append(ar.Response.Warnings, fmt.Sprintf("image security policy %s: %s", v.Policy, v.Reason))
+	}
+	for _, f := range verr.FailedOpen {
+		msg := fmt.Sprintf("image security policy %s failed open for %s: %v", f.Policy, f.Image, f.Err)
+		ar.Response.Warnings = append(ar.Response.Warnings, msg)
+		metrics.RecordFailOpen(ns, f.Policy)
+		if err := ar.recordEvent(ref, v1.EventTypeWarning, "FailOpen", msg); err != nil {
+			glog.Errorf("error recording fail open event for %s/%s: %v", ns, ref.Name, err)
+		}
+	}
+	enforced := &review.ViolationError{
+		Violations: verr.WithAction(kritisv1beta1.EnforcementActionEnforce),
+	}
+	if len(enforced.Violations) == 0 {
+		glog.Infof("admitting images %v, violations are not enforced", images)
+		return
+	}
+	createDeniedResponse(ar, enforced.Error())
+	ar.Response.Result.Details = &metav1.StatusDetails{
+		Causes: violationCauses(enforced),
+	}
+	recordDenialEvents(ar, pod, ref, enforced)
+}
+
+// recordDenialEvents records a warning event per violation type on the workload
+// controlling a denied pod, or on the denied object itself
+func recordDenialEvents(ar *admissionReview, pod *v1.Pod, ref v1.ObjectReference, verr *review.ViolationError) {
+	denied := fmt.Sprintf("denied %s %s", ref.Kind, ref.Name)
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		ref = violation.OwnerReference(ref.Namespace, *owner)
+	}
+	var violations []securitypolicy.SecurityPolicyViolation
+	for _, v := range verr.Violations {
+		violations = append(violations, v.SecurityPolicyViolation)
 	}
-	return
+	for _, e := range violation.Events(violations) {
+		if err := ar.recordEvent(ref, v1.EventTypeWarning, e.Reason, fmt.Sprintf("%s: %s", denied, e.Message)); err != nil {
+			glog.Errorf("error recording %s event for %s %s/%s: %v", e.Reason, ref.Kind, ref.Namespace, ref.Name, err)
+		}
+	}
+}
+
+// recordDecisions records the outcome of every policy reviewed for the object referenced by ref
+func recordDecisions(ref v1.ObjectReference, isps []kritisv1beta1.ImageSecurityPolicy, verr *review.ViolationError) {
+	if len(isps) == 0 {
+		metrics.RecordAdmissionDecision(ref.Kind, ref.Namespace, "", metrics.OutcomeAllowed)
+		return
+	}
+	outcomes := map[string]string{}
+	for _, f := range verr.FailedOpen {
+		outcomes[f.Policy] = metrics.OutcomeFailedOpen
+	}
+	// Violations take precedence over failing open for another image
+	for _, v := range verr.Violations {
+		switch v.EnforcementAction {
+		case kritisv1beta1.EnforcementActionEnforce:
+			outcomes[v.Policy] = metrics.OutcomeDenied
+		case kritisv1beta1.EnforcementActionWarn:
+			if outcomes[v.Policy] != metrics.OutcomeDenied {
+				outcomes[v.Policy] = metrics.OutcomeWarned
+			}
+		case kritisv1beta1.EnforcementActionAudit:
+			if outcomes[v.Policy] != metrics.OutcomeDenied && outcomes[v.Policy] != metrics.OutcomeWarned {
+				outcomes[v.Policy] = metrics.OutcomeAudited
+			}
+		}
+	}
+	for _, isp := range isps {
+		name := securitypolicy.Name(isp)
+		outcome, ok := outcomes[name]
+		if !ok {
+			outcome = metrics.OutcomeAllowed
+		}
+		metrics.RecordAdmissionDecision(ref.Kind, ref.Namespace, name, outcome)
+	}
+}
+
+// newAuditRecord returns the audit record of a request, before it's reviewed
+func newAuditRecord(req *v1beta1.AdmissionRequest) audit.Record {
+	return audit.Record{
+		UID:       string(req.UID),
+		User:      req.UserInfo.Username,
+		Groups:    req.UserInfo.Groups,
+		Operation: string(req.Operation),
+		Kind:      req.Kind.Kind,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+	}
+}
+
+// auditReview adds the policies reviewed and their violations to an audit record
+func auditReview(r *audit.Record, isps []kritisv1beta1.ImageSecurityPolicy, verr *review.ViolationError) {
+	for _, isp := range isps {
+		r.Policies = append(r.Policies, securitypolicy.Name(isp))
+	}
+	for _, v := range verr.Violations {
+		r.Violations = append(r.Violations, audit.Violation{
+			Image:     v.Image,
+			Policy:    v.Policy,
+			Action:    string(v.EnforcementAction),
+			Type:      securitypolicy.ViolationType(v.Violation),
+			CVE:       v.Vulnerability.CVE,
+			Severity:  v.Vulnerability.Severity,
+			CVSSScore: v.Vulnerability.CVSSScore,
+			Reason:    string(v.Reason),
+		})
+	}
+	for _, f := range verr.FailedOpen {
+		r.FailedOpen = append(r.FailedOpen, audit.FailOpen{Image: f.Image, Policy: f.Policy, Error: f.Err.Error()})
+	}
+}
+
+// auditDecision completes the audit record of a review with its outcome, and logs it.
+// Dry run requests aren't audited.
+func auditDecision(ar *admissionReview) {
+	if options.AuditLog == nil || ar.dryRun {
+		return
+	}
+	r := ar.record
+	r.Warnings = ar.Response.Warnings
+	switch {
+	case !ar.Response.Allowed:
+		r.Outcome = metrics.OutcomeDenied
+		r.Message = ar.Response.Result.Message
+	case r.Breakglass != "":
+		r.Outcome = metrics.OutcomeBreakglass
+	default:
+		r.Outcome = metrics.OutcomeAllowed
+	}
+	if err := options.AuditLog.Log(r); err != nil {
+		glog.Errorf("error logging audit record of %s %s/%s: %v", r.Kind, r.Namespace, r.Name, err)
+	}
+}
+
+// violationCauses describes every violation as a status cause, so that
+// all of them are reported in a single denial
+func violationCauses(verr *review.ViolationError) []metav1.StatusCause {
+	causes := []metav1.StatusCause{}
+	for _, v := range verr.Violations {
+		msg := fmt.Sprintf("policy=%s image=%s", v.Policy, v.Image)
+		if v.Vulnerability.CVE != "" {
+			msg += fmt.Sprintf(" cve=%s", v.Vulnerability.CVE)
+		}
+		if v.Vulnerability.Severity != "" {
+			msg += fmt.Sprintf(" severity=%s", v.Vulnerability.Severity)
+		}
+		if v.Vulnerability.CVSSScore != 0 {
+			msg += fmt.Sprintf(" cvss=%.1f", v.Vulnerability.CVSSScore)
+		}
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseType(securitypolicy.ViolationType(v.Violation)),
+			Message: fmt.Sprintf("%s: %s", msg, v.Reason),
+			Field:   v.Container,
+		})
+	}
+	return causes
+}
+
+// objectImages returns the images of every container in a JSON encoded object of
+// the given kind, including the ephemeral containers the vendored API types predate
+func objectImages(kind string, raw []byte) ([]string, error) {
+	if kind == "EphemeralContainers" {
+		return pods.EphemeralImages(raw)
+	}
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+	spec, err := podSpecAt(raw, path)
+	if err != nil {
+		return nil, err
+	}
+	specRaw, err := rawAt(raw, path)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := pods.EphemeralImages(specRaw)
+	if err != nil {
+		return nil, err
+	}
+	return append(pods.Images(v1.Pod{Spec: *spec}), ephemeral...), nil
+}
+
+// objectEphemeralContainers returns the ephemeral containers of a pod, or of the
+// EphemeralContainers object of the pods/ephemeralcontainers subresource
+func objectEphemeralContainers(kind string, raw []byte) ([]v1.Container, error) {
+	if kind == "EphemeralContainers" {
+		return ephemeralContainersAt(raw, "")
+	}
+	return ephemeralContainersAt(raw, podSpecPaths[kind])
 }
 
-func reviewPod(pod *v1.Pod, ar *v1beta1.AdmissionReview) {
-	// First, check for a breakglass annotation on the pod
-	if checkBreakglass(&pod.ObjectMeta) {
-		glog.Infof("found breakglass annotation for %s, returning successful status", pod.Name)
+func reviewPod(pod *v1.Pod, req *v1beta1.AdmissionRequest, ar *admissionReview) {
+	images := pods.Images(*pod)
+	var ephemeral []v1.Container
+	if len(req.Object.Raw) != 0 {
+		all, err := objectImages(req.Kind.Kind, req.Object.Raw)
+		if err == nil {
+			ephemeral, err = objectEphemeralContainers(req.Kind.Kind, req.Object.Raw)
+		}
+		if err != nil {
+			errMsg := fmt.Sprintf("error getting images of %s %s/%s: %v", req.Kind.Kind, req.Namespace, req.Name, err)
+			glog.Error(errMsg)
+			createDeniedResponse(ar, errMsg)
+			return
+		}
+		images = all
+	}
+	images = changedImages(images, req)
+	if len(images) == 0 {
+		glog.Infof("no images changed in pod %s/%s, returning successful status", pod.Namespace, pod.Name)
 		return
 	}
-	reviewImages(pods.Images(*pod), pod.Namespace, pod, ar)
+	// Then, check for a breakglass annotation on the pod
+	if checkBreakglass(&pod.ObjectMeta, images, req, ar) {
+		return
+	}
+	reviewImages(images, pod, ephemeral, objectReference(&pod.ObjectMeta, req), ar)
 }
 
 // TODO(aaron-prindle) remove these functions
@@ -238,16 +679,106 @@ func unmarshalDeployment(r *http.Request) (*appsv1.Deployment, v1beta1.Admission
 	return &deployment, ar, nil
 }
 
-func checkBreakglass(meta *metav1.ObjectMeta) bool {
-	annotations := meta.GetAnnotations()
-	if annotations == nil {
+// SetOptions configures the admission webhook
+func SetOptions(o Options) {
+	options = o
+}
+
+// checkBreakglass returns true if the object carries a breakglass which
+// applies to this request. Every use of a breakglass is logged, recorded
+// as an event and audited along with the images it admits; a breakglass
+// which doesn't apply is reported as a warning.
+func checkBreakglass(meta *metav1.ObjectMeta, images []string, req *v1beta1.AdmissionRequest, ar *admissionReview) bool {
+	ref := objectReference(meta, req)
+	name, ns := ref.Name, ref.Namespace
+	bg, err := breakglass.Get(*meta)
+	if bg == nil && err == nil {
+		return false
+	}
+	if err == nil && bg.Expired(time.Now()) {
+		err = fmt.Errorf("breakglass expired at %s", bg.Expiry.Format(time.RFC3339))
+	}
+	if err == nil && !options.BreakglassRequesters.Allowed(req.UserInfo) {
+		err = fmt.Errorf("user %s is not allowed to use breakglass", req.UserInfo.Username)
+	}
+	if err != nil {
+		glog.Warningf("ignoring breakglass of %s %s/%s: %v", req.Kind.Kind, ns, name, err)
+		ar.Response.Warnings = append(ar.Response.Warnings, fmt.Sprintf("ignoring breakglass: %v", err))
 		return false
 	}
-	_, ok := annotations[kritisconstants.Breakglass]
-	return ok
+	ar.record.Namespace, ar.record.Name = ns, name
+	ar.record.Breakglass = bg.Justification
+	for _, image := range images {
+		ar.record.Images = append(ar.record.Images, audit.NewImage(image))
+	}
+	msg := fmt.Sprintf("breakglass used by %s: %s", req.UserInfo.Username, bg.Justification)
+	glog.Infof("admitting %s %s/%s, %s", req.Kind.Kind, ns, name, msg)
+	metrics.RecordBreakglass(req.Kind.Kind, ns)
+	metrics.RecordAdmissionDecision(req.Kind.Kind, ns, "", metrics.OutcomeBreakglass)
+	if err := ar.recordEvent(ref, v1.EventTypeWarning, "Breakglass", msg); err != nil {
+		glog.Errorf("error recording breakglass event for %s/%s: %v", ns, name, err)
+	}
+	return true
+}
+
+// checkTemplateBreakglass returns an error if the requester of a workload isn't allowed
+// to use a breakglass and adds or changes one in its pod template
+func checkTemplateBreakglass(template metav1.ObjectMeta, req *v1beta1.AdmissionRequest) error {
+	if !breakglass.Has(template) || options.BreakglassRequesters.Allowed(req.UserInfo) {
+		return nil
+	}
+	if req.Operation == v1beta1.Update && len(req.OldObject.Raw) != 0 {
+		if old, err := templateMetaAt(req.Kind.Kind, req.OldObject.Raw); err == nil && !breakglass.Changed(*old, template) {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s is not allowed to set a breakglass in the pod template", req.UserInfo.Username)
+}
+
+// templateMetaAt returns the metadata of the pod template of a JSON encoded workload of the given kind
+func templateMetaAt(kind string, raw []byte) (*metav1.ObjectMeta, error) {
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+	b, err := rawAt(raw, strings.TrimSuffix(path, "/spec")+"/metadata")
+	if err != nil {
+		return nil, err
+	}
+	meta := &metav1.ObjectMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// objectReference references the object of an admission request, falling back to
+// the namespace of the request and the generated name prefix if they aren't set yet
+func objectReference(meta *metav1.ObjectMeta, req *v1beta1.AdmissionRequest) v1.ObjectReference {
+	ref := v1.ObjectReference{
+		Kind:       req.Kind.Kind,
+		APIVersion: metav1.GroupVersion{Group: req.Kind.Group, Version: req.Kind.Version}.String(),
+		Namespace:  meta.Namespace,
+		Name:       meta.Name,
+		UID:        meta.UID,
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = req.Namespace
+	}
+	if ref.Name == "" {
+		ref.Name = meta.GenerateName
+	}
+	return ref
 }
 
 // TODO: update this once we have more metadata clients
 func metadataClient() (metadata.MetadataFetcher, error) {
-	return containeranalysis.NewContainerAnalysisClient()
+	if options.MetadataClient != nil {
+		return options.MetadataClient, nil
+	}
+	client, err := containeranalysis.NewContainerAnalysisClient()
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Instrumented(client, containeranalysis.Backend), nil
 }
@@ -17,21 +17,32 @@ limitations under the License.
 package admission
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/grafeas/kritis/cmd/kritis/version"
 	"github.com/grafeas/kritis/pkg/kritis/admission/constants"
 	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/audit"
+	"github.com/grafeas/kritis/pkg/kritis/breakglass"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
 	"github.com/grafeas/kritis/pkg/kritis/testutil"
 	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -41,6 +52,12 @@ type testConfig struct {
 	allowed    bool
 	status     constants.Status
 	message    string
+	causes     []metav1.StatusCause
+}
+
+// noEvents drops the events of tests which don't check them
+func noEvents(ref v1.ObjectReference, eventType, reason, message string) error {
+	return nil
 }
 
 // TODO (tejaldesai): Move these tests to review/review_test.go and mock
@@ -49,12 +66,22 @@ func Test_BreakglassAnnotation(t *testing.T) {
 	mockPod := func(r *http.Request) (*v1.Pod, v1beta1.AdmissionReview, error) {
 		return &v1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
-				Annotations: map[string]string{"kritis.grafeas.io/breakglass": "true"},
+				Annotations: map[string]string{"kritis.grafeas.io/breakglass": "hotfix for incident 42"},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Image: "image:tag",
+					},
+				},
 			},
 		}, v1beta1.AdmissionReview{}, nil
 	}
 	mockConfig := config{
 		retrievePod: mockPod,
+		recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+			return nil
+		},
 	}
 	RunTest(t, testConfig{
 		mockConfig: mockConfig,
@@ -64,6 +91,74 @@ func Test_BreakglassAnnotation(t *testing.T) {
 		message:    constants.SuccessMessage,
 	})
 }
+
+func Test_CheckBreakglass(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"sre"}}
+	bob := authenticationv1.UserInfo{Username: "bob", Groups: []string{"dev"}}
+	controller := authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:replicaset-controller"}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		requesters  breakglass.Requesters
+		user        authenticationv1.UserInfo
+		expected    bool
+	}{
+		{"no breakglass", nil, breakglass.Requesters{}, alice, false},
+		{"no justification", map[string]string{"kritis.grafeas.io/breakglass": "true"}, breakglass.Requesters{}, alice, false},
+		{"justification", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, breakglass.Requesters{}, alice, true},
+		{"not expired", map[string]string{"kritis.grafeas.io/breakglass": "hotfix", "kritis.grafeas.io/breakglass-expiry": future}, breakglass.Requesters{}, alice, true},
+		{"expired", map[string]string{"kritis.grafeas.io/breakglass": "hotfix", "kritis.grafeas.io/breakglass-expiry": past}, breakglass.Requesters{}, alice, false},
+		{"invalid expiry", map[string]string{"kritis.grafeas.io/breakglass": "hotfix", "kritis.grafeas.io/breakglass-expiry": "tomorrow"}, breakglass.Requesters{}, alice, false},
+		{"allowed user", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, breakglass.Requesters{Users: []string{"alice"}}, alice, true},
+		{"allowed group", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, breakglass.Requesters{Groups: []string{"sre"}}, alice, true},
+		{"disallowed requester", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, breakglass.Requesters{Users: []string{"alice"}, Groups: []string{"sre"}}, bob, false},
+		{"controller", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, breakglass.Requesters{Users: []string{"alice"}}, controller, true},
+	}
+	originalConfig, originalOptions := admissionConfig, options
+	defer func() {
+		admissionConfig, options = originalConfig, originalOptions
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []string
+			admissionConfig = config{
+				recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+					if ref.Kind != "Pod" || ref.Namespace != "ns" || ref.Name != "pod" {
+						t.Errorf("unexpected event object %v", ref)
+					}
+					events = append(events, message)
+					return nil
+				},
+			}
+			SetOptions(Options{BreakglassRequesters: test.requesters})
+			meta := metav1.ObjectMeta{Name: "pod", Annotations: test.annotations}
+			req := &v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+				Namespace: "ns",
+				UserInfo:  test.user,
+			}
+			ar := newAdmissionReview("", types.UID(""))
+			if got := checkBreakglass(&meta, []string{"image:tag"}, req, ar); got != test.expected {
+				t.Errorf("got %t, expected %t", got, test.expected)
+			}
+			if test.expected {
+				expected := fmt.Sprintf("breakglass used by %s: hotfix", test.user.Username)
+				if len(events) != 1 || events[0] != expected {
+					t.Errorf("got events %v, expected [%s]", events, expected)
+				}
+			} else if len(events) != 0 {
+				t.Errorf("unexpected events %v", events)
+			}
+			// A breakglass which doesn't apply is reported back to the requester
+			if hasWarning := len(ar.Response.Warnings) != 0; hasWarning != (!test.expected && test.annotations != nil) {
+				t.Errorf("unexpected warnings %v", ar.Response.Warnings)
+			}
+		})
+	}
+}
+
 func Test_UnqualifiedImage(t *testing.T) {
 	mockPod := func(r *http.Request) (*v1.Pod, v1beta1.AdmissionReview, error) {
 		return &v1.Pod{
@@ -81,6 +176,7 @@ func Test_UnqualifiedImage(t *testing.T) {
 	}
 
 	mockConfig := config{
+		recordEvent:                noEvents,
 		retrievePod:                mockPod,
 		fetchMetadataClient:        testutil.NilFetcher(),
 		fetchImageSecurityPolicies: mockISP,
@@ -91,6 +187,13 @@ func Test_UnqualifiedImage(t *testing.T) {
 		allowed:    false,
 		status:     constants.FailureStatus,
 		message:    "image:tag is not a fully qualified image",
+		causes: []metav1.StatusCause{
+			{
+				Type:    "UnqualifiedImage",
+				Message: "policy= image=image:tag: image:tag is not a fully qualified image",
+				Field:   "spec.containers{}",
+			},
+		},
 	})
 }
 
@@ -108,6 +211,7 @@ func Test_ValidISP(t *testing.T) {
 		}, nil
 	}
 	mockConfig := config{
+		recordEvent:                noEvents,
 		retrievePod:                mockValidPod(),
 		fetchMetadataClient:        testutil.NilFetcher(),
 		fetchImageSecurityPolicies: mockISP,
@@ -147,6 +251,7 @@ func Test_InvalidISP(t *testing.T) {
 		}, nil
 	}
 	mockConfig := config{
+		recordEvent:                noEvents,
 		retrievePod:                mockValidPod(),
 		fetchMetadataClient:        mockMetadata,
 		fetchImageSecurityPolicies: mockISP,
@@ -157,6 +262,90 @@ func Test_InvalidISP(t *testing.T) {
 		allowed:    false,
 		status:     constants.FailureStatus,
 		message:    fmt.Sprintf("found violations in %s", testutil.QualifiedImage),
+		causes: []metav1.StatusCause{
+			{
+				Type: "ExceedsMaxSeverity",
+				Message: fmt.Sprintf("policy= image=%s severity=MEDIUM: found CVE  in %s, which has severity MEDIUM exceeding max severity LOW",
+					testutil.QualifiedImage, testutil.QualifiedImage),
+				Field: "spec.containers{}",
+			},
+		},
+	})
+}
+
+func Test_AllViolationsReported(t *testing.T) {
+	mockISP := func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+		return []kritisv1beta1.ImageSecurityPolicy{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "low"},
+				Spec: kritisv1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: kritisv1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity: "LOW",
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "medium"},
+				Spec: kritisv1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: kritisv1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity: "MEDIUM",
+					},
+				},
+			},
+		}, nil
+	}
+	mockMetadata := func() (metadata.MetadataFetcher, error) {
+		return testutil.MockMetadataClient{
+			Vulnz: []metadata.Vulnerability{
+				{CVE: "m", Severity: "MEDIUM"},
+				{CVE: "h", Severity: "HIGH"},
+			},
+		}, nil
+	}
+	mockPod := func(r *http.Request) (*v1.Pod, v1beta1.AdmissionReview, error) {
+		return &v1.Pod{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{Name: "qualified", Image: testutil.QualifiedImage},
+					{Name: "unqualified", Image: "image:tag"},
+				},
+			},
+		}, v1beta1.AdmissionReview{}, nil
+	}
+	mockConfig := config{
+		recordEvent:                noEvents,
+		retrievePod:                mockPod,
+		fetchMetadataClient:        mockMetadata,
+		fetchImageSecurityPolicies: mockISP,
+	}
+	cause := func(policy, cve, severity, max string) metav1.StatusCause {
+		return metav1.StatusCause{
+			Type: "ExceedsMaxSeverity",
+			Message: fmt.Sprintf("policy=%s image=%s cve=%s severity=%s: found CVE %s in %s, which has severity %s exceeding max severity %s",
+				policy, testutil.QualifiedImage, cve, severity, cve, testutil.QualifiedImage, severity, max),
+			Field: "spec.containers{qualified}",
+		}
+	}
+	unqualified := func(policy string) metav1.StatusCause {
+		return metav1.StatusCause{
+			Type:    "UnqualifiedImage",
+			Message: fmt.Sprintf("policy=%s image=image:tag: image:tag is not a fully qualified image", policy),
+			Field:   "spec.containers{unqualified}",
+		}
+	}
+	RunTest(t, testConfig{
+		mockConfig: mockConfig,
+		httpStatus: http.StatusOK,
+		allowed:    false,
+		status:     constants.FailureStatus,
+		message:    fmt.Sprintf("image:tag is not a fully qualified image; found violations in %s", testutil.QualifiedImage),
+		causes: []metav1.StatusCause{
+			cause("low", "m", "MEDIUM", "LOW"),
+			cause("low", "h", "HIGH", "LOW"),
+			cause("medium", "h", "HIGH", "MEDIUM"),
+			unqualified("low"),
+			unqualified("medium"),
+		},
 	})
 }
 
@@ -182,6 +371,7 @@ func Test_GlobalWhitelist(t *testing.T) {
 		}, v1beta1.AdmissionReview{}, nil
 	}
 	mockConfig := config{
+		recordEvent:                noEvents,
 		retrievePod:                mockPod,
 		fetchMetadataClient:        testutil.NilFetcher(),
 		fetchImageSecurityPolicies: mockISP,
@@ -233,6 +423,14 @@ func RunTest(t *testing.T, tc testConfig) {
 	// Check the response body is what we expect.
 	expected := `{"response":{"uid":"","allowed":%t,"status":{"metadata":{},"status":"%s","message":"%s"}}}`
 	expected = fmt.Sprintf(expected, tc.allowed, tc.status, tc.message)
+	if tc.causes != nil {
+		causes, err := json.Marshal(metav1.StatusDetails{Causes: tc.causes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = `{"response":{"uid":"","allowed":%t,"status":{"metadata":{},"status":"%s","message":"%s","details":%s}}}`
+		expected = fmt.Sprintf(expected, tc.allowed, tc.status, tc.message, causes)
+	}
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), expected)
@@ -250,17 +448,10 @@ func PodTestReviewHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	admitResponse := &v1beta1.AdmissionReview{
-		Response: &v1beta1.AdmissionResponse{
-			UID:     types.UID(""),
-			Allowed: true,
-			Result: &metav1.Status{
-				Status:  string(constants.SuccessStatus),
-				Message: constants.SuccessMessage,
-			},
-		},
+	admitResponse := &admissionReview{
+		Response: newAdmissionReview("", types.UID("")).Response,
 	}
-	reviewPod(pod, admitResponse)
+	reviewPod(pod, &v1beta1.AdmissionRequest{Kind: metav1.GroupVersionKind{Kind: "Pod"}}, admitResponse)
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	payload, err := json.Marshal(admitResponse)
@@ -269,3 +460,682 @@ func PodTestReviewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write(payload)
 }
+
+func Test_WorkloadHandlers(t *testing.T) {
+	template := v1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Image: "image:tag",
+				},
+			},
+		},
+	}
+	tests := []struct {
+		kind   string
+		object interface{}
+	}{
+		{"Deployment", appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: template}}},
+		{"ReplicaSet", appsv1.ReplicaSet{Spec: appsv1.ReplicaSetSpec{Template: template}}},
+		{"StatefulSet", appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Template: template}}},
+		{"DaemonSet", appsv1.DaemonSet{Spec: appsv1.DaemonSetSpec{Template: template}}},
+		{"ReplicationController", v1.ReplicationController{Spec: v1.ReplicationControllerSpec{Template: &template}}},
+		{"Job", batchv1.Job{Spec: batchv1.JobSpec{Template: template}}},
+		{"CronJob", batchv1beta1.CronJob{Spec: batchv1beta1.CronJobSpec{
+			JobTemplate: batchv1beta1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}},
+		}}},
+	}
+	original := admissionConfig
+	defer func() {
+		admissionConfig = original
+	}()
+	admissionConfig = config{
+		recordEvent:         noEvents,
+		fetchMetadataClient: testutil.NilFetcher(),
+		fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+			return []kritisv1beta1.ImageSecurityPolicy{{}}, nil
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			raw, err := json.Marshal(test.object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar := v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Kind:   metav1.GroupVersionKind{Kind: test.kind},
+					Object: runtime.RawExtension{Raw: raw},
+				},
+			}
+			body, err := json.Marshal(ar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			AdmissionReviewHandler(rr, req)
+			response := v1beta1.AdmissionReview{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Response.Allowed {
+				t.Errorf("expected %s with unqualified image to be denied", test.kind)
+			}
+			if response.Response.Result.Message != "image:tag is not a fully qualified image" {
+				t.Errorf("unexpected message for %s: %s", test.kind, response.Response.Result.Message)
+			}
+		})
+	}
+}
+
+func Test_AdmissionReviewVersions(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		httpStatus int
+		expected   string
+	}{
+		{"v1", constants.AdmissionV1, http.StatusOK, constants.AdmissionV1},
+		{"v1beta1", constants.AdmissionV1beta1, http.StatusOK, constants.AdmissionV1beta1},
+		{"no version", "", http.StatusOK, constants.AdmissionV1beta1},
+		{"unsupported version", "admission.k8s.io/v2", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ar := v1beta1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: test.apiVersion,
+					Kind:       constants.AdmissionReviewKind,
+				},
+				Request: &v1beta1.AdmissionRequest{
+					UID:  types.UID("uid"),
+					Kind: metav1.GroupVersionKind{Kind: "Service"},
+				},
+			}
+			body, err := json.Marshal(ar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			AdmissionReviewHandler(rr, req)
+			if rr.Code != test.httpStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.httpStatus)
+			}
+			if test.httpStatus != http.StatusOK {
+				return
+			}
+			response := v1beta1.AdmissionReview{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.APIVersion != test.expected || response.Kind != constants.AdmissionReviewKind {
+				t.Errorf("got response version %s/%s, expected %s/%s",
+					response.APIVersion, response.Kind, test.expected, constants.AdmissionReviewKind)
+			}
+			if response.Response.UID != ar.Request.UID {
+				t.Errorf("got response uid %s, expected %s", response.Response.UID, ar.Request.UID)
+			}
+		})
+	}
+}
+
+func Test_EnforcementActions(t *testing.T) {
+	isp := func(name string, action kritisv1beta1.EnforcementAction) kritisv1beta1.ImageSecurityPolicy {
+		return kritisv1beta1.ImageSecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: kritisv1beta1.ImageSecurityPolicySpec{
+				EnforcementAction: action,
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		isps     []kritisv1beta1.ImageSecurityPolicy
+		allowed  bool
+		warnings []string
+		causes   int
+	}{
+		{
+			name:    "default",
+			isps:    []kritisv1beta1.ImageSecurityPolicy{isp("default", "")},
+			allowed: false,
+			causes:  1,
+		},
+		{
+			name:    "enforce",
+			isps:    []kritisv1beta1.ImageSecurityPolicy{isp("enforce", kritisv1beta1.EnforcementActionEnforce)},
+			allowed: false,
+			causes:  1,
+		},
+		{
+			name:     "warn",
+			isps:     []kritisv1beta1.ImageSecurityPolicy{isp("warn", kritisv1beta1.EnforcementActionWarn)},
+			allowed:  true,
+			warnings: []string{"image security policy warn: image:tag is not a fully qualified image"},
+		},
+		{
+			name:    "audit",
+			isps:    []kritisv1beta1.ImageSecurityPolicy{isp("audit", kritisv1beta1.EnforcementActionAudit)},
+			allowed: true,
+		},
+		{
+			name: "enforce, warn and audit",
+			isps: []kritisv1beta1.ImageSecurityPolicy{
+				isp("enforce", kritisv1beta1.EnforcementActionEnforce),
+				isp("warn", kritisv1beta1.EnforcementActionWarn),
+				isp("audit", kritisv1beta1.EnforcementActionAudit),
+			},
+			allowed:  false,
+			warnings: []string{"image security policy warn: image:tag is not a fully qualified image"},
+			causes:   1,
+		},
+	}
+	original := admissionConfig
+	defer func() {
+		admissionConfig = original
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			admissionConfig = config{
+				recordEvent:         noEvents,
+				fetchMetadataClient: testutil.NilFetcher(),
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return test.isps, nil
+				},
+			}
+			ar := newAdmissionReview("", types.UID(""))
+			reviewImages([]string{"image:tag"}, &v1.Pod{}, nil, v1.ObjectReference{}, ar)
+			if ar.Response.Allowed != test.allowed {
+				t.Errorf("got allowed %t, expected %t", ar.Response.Allowed, test.allowed)
+			}
+			testutil.CheckErrorAndDeepEqual(t, false, nil, test.warnings, ar.Response.Warnings)
+			var causes int
+			if ar.Response.Result.Details != nil {
+				causes = len(ar.Response.Result.Details.Causes)
+			}
+			if causes != test.causes {
+				t.Errorf("got %d causes, expected %d", causes, test.causes)
+			}
+		})
+	}
+}
+
+// slowFetcher answers vulnerability lookups after delay
+type slowFetcher struct {
+	testutil.MockMetadataClient
+	delay time.Duration
+}
+
+func (f slowFetcher) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
+	time.Sleep(f.delay)
+	return nil, nil
+}
+
+func Test_FailurePolicies(t *testing.T) {
+	unavailable := func() (metadata.MetadataFetcher, error) {
+		return nil, fmt.Errorf("backend unavailable")
+	}
+	slow := func() (metadata.MetadataFetcher, error) {
+		return slowFetcher{delay: time.Second}, nil
+	}
+	isp := func(p kritisv1beta1.FailurePolicy) kritisv1beta1.ImageSecurityPolicy {
+		return kritisv1beta1.ImageSecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "isp"},
+			Spec:       kritisv1beta1.ImageSecurityPolicySpec{FailurePolicy: p},
+		}
+	}
+	tests := []struct {
+		name          string
+		fetcher       func() (metadata.MetadataFetcher, error)
+		clusterPolicy kritisv1beta1.FailurePolicy
+		isp           kritisv1beta1.ImageSecurityPolicy
+		allowed       bool
+	}{
+		{"closed", unavailable, kritisv1beta1.FailurePolicyClosed, isp(""), false},
+		{"open", unavailable, kritisv1beta1.FailurePolicyOpen, isp(""), true},
+		{"policy overrides closed", unavailable, kritisv1beta1.FailurePolicyClosed, isp(kritisv1beta1.FailurePolicyOpen), true},
+		{"policy overrides open", unavailable, kritisv1beta1.FailurePolicyOpen, isp(kritisv1beta1.FailurePolicyClosed), false},
+		{"deadline closed", slow, kritisv1beta1.FailurePolicyClosed, isp(""), false},
+		{"deadline open", slow, kritisv1beta1.FailurePolicyOpen, isp(""), true},
+	}
+	originalConfig, originalOptions := admissionConfig, options
+	defer func() {
+		admissionConfig, options = originalConfig, originalOptions
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []string
+			admissionConfig = config{
+				fetchMetadataClient: test.fetcher,
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return []kritisv1beta1.ImageSecurityPolicy{test.isp}, nil
+				},
+				recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+					events = append(events, reason)
+					return nil
+				},
+			}
+			SetOptions(Options{FailurePolicy: test.clusterPolicy, ReviewTimeout: 10 * time.Millisecond})
+			ar := newAdmissionReview("", types.UID(""))
+			reviewImages([]string{testutil.QualifiedImage}, &v1.Pod{}, nil, v1.ObjectReference{Namespace: "ns"}, ar)
+			if ar.Response.Allowed != test.allowed {
+				t.Errorf("got allowed %t, expected %t: %s", ar.Response.Allowed, test.allowed, ar.Response.Result.Message)
+			}
+			// Every fail open admission is reported to the requester and recorded as an event
+			failedOpen := 0
+			if test.allowed {
+				failedOpen = 1
+			}
+			if len(ar.Response.Warnings) != failedOpen {
+				t.Errorf("got warnings %v, expected %d", ar.Response.Warnings, failedOpen)
+			}
+			if len(events) != failedOpen {
+				t.Errorf("got events %v, expected %d", events, failedOpen)
+			}
+		})
+	}
+}
+
+func Test_TemplateBreakglass(t *testing.T) {
+	deployment := func(annotations map[string]string) appsv1.Deployment {
+		return appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Image: testutil.QualifiedImage}}},
+		}}}
+	}
+	hotfix := map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}
+	alice := authenticationv1.UserInfo{Username: "alice"}
+	bob := authenticationv1.UserInfo{Username: "bob"}
+	tests := []struct {
+		name      string
+		user      authenticationv1.UserInfo
+		oldObject interface{}
+		object    appsv1.Deployment
+		allowed   bool
+	}{
+		{"no breakglass", bob, nil, deployment(nil), true},
+		{"allowed requester", alice, nil, deployment(hotfix), true},
+		{"disallowed requester", bob, nil, deployment(hotfix), false},
+		{"unchanged breakglass", bob, deployment(hotfix), deployment(hotfix), true},
+		{"changed breakglass", bob, deployment(map[string]string{"kritis.grafeas.io/breakglass": "old"}), deployment(hotfix), false},
+	}
+	originalConfig, originalOptions := admissionConfig, options
+	defer func() {
+		admissionConfig, options = originalConfig, originalOptions
+	}()
+	SetOptions(Options{BreakglassRequesters: breakglass.Requesters{Users: []string{"alice"}}})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			admissionConfig = config{
+				recordEvent:         noEvents,
+				fetchMetadataClient: testutil.NilFetcher(),
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return nil, nil
+				},
+			}
+			req := &v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: "Deployment"},
+				Operation: v1beta1.Create,
+				UserInfo:  test.user,
+			}
+			var err error
+			if req.Object.Raw, err = json.Marshal(test.object); err != nil {
+				t.Fatal(err)
+			}
+			if test.oldObject != nil {
+				req.Operation = v1beta1.Update
+				if req.OldObject.Raw, err = json.Marshal(test.oldObject); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ar := newAdmissionReview("", types.UID(""))
+			handlers["Deployment"](&v1beta1.AdmissionReview{Request: req}, ar)
+			if ar.Response.Allowed != test.allowed {
+				t.Errorf("got allowed %t, expected %t", ar.Response.Allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func Test_UpdateRequests(t *testing.T) {
+	pod := func(labels map[string]string, images ...string) v1.Pod {
+		p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+		for _, i := range images {
+			p.Spec.Containers = append(p.Spec.Containers, v1.Container{Image: i})
+		}
+		return p
+	}
+	deployment := func(replicas int32, images ...string) appsv1.Deployment {
+		p := pod(nil, images...)
+		return appsv1.Deployment{Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{Spec: p.Spec},
+		}}
+	}
+	tests := []struct {
+		name      string
+		kind      string
+		operation v1beta1.Operation
+		oldObject interface{}
+		object    interface{}
+		reviewed  []string
+		// field is the field of the first denial cause, if set
+		field string
+	}{
+		{
+			name:      "pod label edit",
+			kind:      "Pod",
+			operation: v1beta1.Update,
+			oldObject: pod(nil, "image:tag"),
+			object:    pod(map[string]string{"app": "foo"}, "image:tag"),
+		},
+		{
+			name:      "pod image change",
+			kind:      "Pod",
+			operation: v1beta1.Update,
+			oldObject: pod(nil, "image:tag", "other:tag"),
+			object:    pod(nil, "image:tag", "other:new"),
+			reviewed:  []string{"other:new"},
+		},
+		{
+			name:      "deployment scale",
+			kind:      "Deployment",
+			operation: v1beta1.Update,
+			oldObject: deployment(1, "image:tag"),
+			object:    deployment(3, "image:tag"),
+		},
+		{
+			name:      "deployment image change",
+			kind:      "Deployment",
+			operation: v1beta1.Update,
+			oldObject: deployment(1, "image:tag"),
+			object:    deployment(1, "image:new"),
+			reviewed:  []string{"image:new"},
+		},
+		{
+			name:      "debug container",
+			kind:      "Pod",
+			operation: v1beta1.Update,
+			oldObject: pod(nil, "image:tag"),
+			object: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers":          []interface{}{map[string]interface{}{"image": "image:tag"}},
+					"ephemeralContainers": []interface{}{map[string]interface{}{"name": "debug", "image": "debug:tag"}},
+				},
+			},
+			reviewed: []string{"debug:tag"},
+			field:    "spec.ephemeralContainers{debug}",
+		},
+		{
+			name:      "ephemeralcontainers subresource",
+			kind:      "EphemeralContainers",
+			operation: v1beta1.Update,
+			oldObject: map[string]interface{}{"ephemeralContainers": []interface{}{}},
+			object: map[string]interface{}{
+				"ephemeralContainers": []interface{}{map[string]interface{}{"name": "debug", "image": "debug:tag"}},
+			},
+			reviewed: []string{"debug:tag"},
+			field:    "spec.ephemeralContainers{debug}",
+		},
+		{
+			name:      "ephemeralcontainers unchanged",
+			kind:      "EphemeralContainers",
+			operation: v1beta1.Update,
+			oldObject: map[string]interface{}{"ephemeralContainers": []interface{}{map[string]interface{}{"image": "debug:tag"}}},
+			object: map[string]interface{}{
+				"metadata":            map[string]interface{}{"labels": map[string]interface{}{"app": "foo"}},
+				"ephemeralContainers": []interface{}{map[string]interface{}{"image": "debug:tag"}},
+			},
+		},
+		{
+			name:      "create",
+			kind:      "Deployment",
+			operation: v1beta1.Create,
+			object:    deployment(1, "image:tag"),
+			reviewed:  []string{"image:tag"},
+		},
+	}
+	original := admissionConfig
+	defer func() {
+		admissionConfig = original
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetched := false
+			admissionConfig = config{
+				recordEvent:         noEvents,
+				fetchMetadataClient: testutil.NilFetcher(),
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					fetched = true
+					return []kritisv1beta1.ImageSecurityPolicy{{}}, nil
+				},
+			}
+			req := &v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: test.kind},
+				Operation: test.operation,
+			}
+			raw, err := json.Marshal(test.object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Object = runtime.RawExtension{Raw: raw}
+			if test.oldObject != nil {
+				if req.OldObject.Raw, err = json.Marshal(test.oldObject); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ar := newAdmissionReview("", types.UID(""))
+			handlers[test.kind](&v1beta1.AdmissionReview{Request: req}, ar)
+			if fetched != (len(test.reviewed) != 0) {
+				t.Errorf("got reviewed %t, expected images %v to be reviewed", fetched, test.reviewed)
+			}
+			if ar.Response.Allowed != (len(test.reviewed) == 0) {
+				t.Errorf("got allowed %t: %s", ar.Response.Allowed, ar.Response.Result.Message)
+			}
+			for _, image := range test.reviewed {
+				expected := fmt.Sprintf("%s is not a fully qualified image", image)
+				if ar.Response.Result.Message != expected {
+					t.Errorf("got message %q, expected %q", ar.Response.Result.Message, expected)
+				}
+			}
+			if test.field != "" {
+				if causes := ar.Response.Result.Details.Causes; len(causes) == 0 || causes[0].Field != test.field {
+					t.Errorf("got causes %v, expected the field %s", causes, test.field)
+				}
+			}
+		})
+	}
+}
+
+func Test_AuditLog(t *testing.T) {
+	digest := "gcr.io/image/digest@sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    audit.Record
+	}{
+		{
+			name: "denied",
+			expected: audit.Record{
+				Images:   []audit.Image{{Image: "image:tag"}, {Image: digest, Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"}},
+				Policies: []string{"isp"},
+				Violations: []audit.Violation{{
+					Image:  "image:tag",
+					Policy: "isp",
+					Action: "enforce",
+					Type:   "UnqualifiedImage",
+					Reason: "image:tag is not a fully qualified image",
+				}},
+				Outcome: "denied",
+				Message: "image:tag is not a fully qualified image",
+			},
+		},
+		{
+			name:        "breakglass",
+			annotations: map[string]string{"kritis.grafeas.io/breakglass": "hotfix"},
+			expected: audit.Record{
+				Images:     []audit.Image{{Image: "image:tag"}, {Image: digest, Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"}},
+				Breakglass: "hotfix",
+				Outcome:    "breakglass",
+			},
+		},
+	}
+	originalConfig, originalOptions := admissionConfig, options
+	defer func() {
+		admissionConfig, options = originalConfig, originalOptions
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := audit.NewLogger(audit.NewWriterSink("buffer", &buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			admissionConfig = config{
+				recordEvent: noEvents,
+				fetchMetadataClient: func() (metadata.MetadataFetcher, error) {
+					return testutil.MockMetadataClient{}, nil
+				},
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return []kritisv1beta1.ImageSecurityPolicy{{ObjectMeta: metav1.ObjectMeta{Name: "isp"}}}, nil
+				},
+			}
+			SetOptions(Options{AuditLog: logger})
+			raw, err := json.Marshal(v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: test.annotations},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Image: "image:tag"}, {Image: digest}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := json.Marshal(v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("uid"),
+					Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+					Namespace: "ns",
+					Operation: v1beta1.Create,
+					UserInfo:  authenticationv1.UserInfo{Username: "alice"},
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			AdmissionReviewHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+			logger.Close()
+
+			if err := audit.Verify(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			var record audit.Record
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			expected := test.expected
+			expected.Time, expected.Hash = record.Time, record.Hash
+			expected.UID, expected.User, expected.Operation = "uid", "alice", "CREATE"
+			expected.Kind, expected.Namespace, expected.Name = "Pod", "ns", "pod"
+			if !reflect.DeepEqual(record, expected) {
+				t.Errorf("got audit record\n%+v\nexpected\n%+v", record, expected)
+			}
+		})
+	}
+}
+
+func Test_DryRun(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := audit.NewLogger(audit.NewWriterSink("buffer", &buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalConfig, originalOptions := admissionConfig, options
+	defer func() {
+		admissionConfig, options = originalConfig, originalOptions
+	}()
+	events := 0
+	admissionConfig = config{
+		recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+			events++
+			return nil
+		},
+		fetchMetadataClient: testutil.NilFetcher(),
+		fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+			return []kritisv1beta1.ImageSecurityPolicy{{}}, nil
+		},
+	}
+	SetOptions(Options{AuditLog: logger})
+	body := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"uid","dryRun":true,
+"kind":{"version":"v1","kind":"Pod"},"namespace":"ns","operation":"CREATE",
+"object":{"metadata":{"name":"pod"},"spec":{"containers":[{"image":"image:tag"}]}}}}`
+	w := httptest.NewRecorder()
+	AdmissionReviewHandler(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	logger.Close()
+
+	if !strings.Contains(w.Body.String(), `"allowed":false`) {
+		t.Errorf("expected a dry run to be reviewed and denied, got %s", w.Body.String())
+	}
+	if events != 0 {
+		t.Errorf("got %d events recorded for a dry run", events)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got audit records for a dry run: %s", buf.String())
+	}
+}
+
+func Test_DenialEvents(t *testing.T) {
+	isController := true
+	tests := []struct {
+		name     string
+		owners   []metav1.OwnerReference
+		expected v1.ObjectReference
+	}{
+		{
+			name:     "pod",
+			expected: v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: "ns", Name: "pod"},
+		},
+		{
+			name:     "owned pod",
+			owners:   []metav1.OwnerReference{{Kind: "ReplicaSet", APIVersion: "apps/v1", Name: "rs", Controller: &isController}},
+			expected: v1.ObjectReference{Kind: "ReplicaSet", APIVersion: "apps/v1", Namespace: "ns", Name: "rs"},
+		},
+	}
+	originalConfig := admissionConfig
+	defer func() {
+		admissionConfig = originalConfig
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var refs []v1.ObjectReference
+			var reasons []string
+			admissionConfig = config{
+				fetchMetadataClient: testutil.NilFetcher(),
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return []kritisv1beta1.ImageSecurityPolicy{{}}, nil
+				},
+				recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+					refs = append(refs, ref)
+					reasons = append(reasons, reason)
+					return nil
+				},
+			}
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", OwnerReferences: test.owners},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Image: "image:tag"}}},
+			}
+			req := &v1beta1.AdmissionRequest{Kind: metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}}
+			ar := newAdmissionReview("", types.UID(""))
+			reviewPod(pod, req, ar)
+			if ar.Response.Allowed {
+				t.Fatal("expected the pod to be denied")
+			}
+			if !reflect.DeepEqual(refs, []v1.ObjectReference{test.expected}) {
+				t.Errorf("got events on %v, expected %v", refs, test.expected)
+			}
+			if !reflect.DeepEqual(reasons, []string{"UnqualifiedImage"}) {
+				t.Errorf("got event reasons %v, expected UnqualifiedImage", reasons)
+			}
+		})
+	}
+}
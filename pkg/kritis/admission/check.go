@@ -0,0 +1,195 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/pods"
+	"github.com/grafeas/kritis/pkg/kritis/review"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/core/v1"
+)
+
+// maxCheckRequest bounds the size of a check request
+const maxCheckRequest = 1 << 20
+
+// CheckRequest asks whether images, or the images of a pod spec, would be
+// admitted in a namespace
+type CheckRequest struct {
+	Namespace string      `json:"namespace"`
+	Images    []string    `json:"images,omitempty"`
+	PodSpec   *v1.PodSpec `json:"podSpec,omitempty"`
+}
+
+// CheckViolation is a violation of a policy by an image
+type CheckViolation struct {
+	Image     string  `json:"image"`
+	Policy    string  `json:"policy"`
+	Action    string  `json:"action"`
+	Type      string  `json:"type"`
+	CVE       string  `json:"cve,omitempty"`
+	Severity  string  `json:"severity,omitempty"`
+	CVSSScore float64 `json:"cvssScore,omitempty"`
+	Reason    string  `json:"reason"`
+}
+
+// CheckResponse is the decision the validating webhook would make
+type CheckResponse struct {
+	Allowed    bool             `json:"allowed"`
+	Message    string           `json:"message,omitempty"`
+	Images     []string         `json:"images"`
+	Policies   []string         `json:"policies"`
+	Violations []CheckViolation `json:"violations"`
+	Warnings   []string         `json:"warnings,omitempty"`
+}
+
+// CheckHandler serves POST /v1/check. It reviews images against the image
+// security policies of a namespace, as the validating webhook would, without
+// handling the violations found. Callers authenticate with a bearer token, and
+// must be allowed to get imagesecuritypolicies in the namespace. The token is
+// authenticated before the body is read, so anonymous callers can't probe the decoder.
+func CheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	user, err := authenticateCheck(r)
+	if err != nil {
+		glog.Warningf("rejecting check request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var req CheckRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckRequest)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("can't decode check request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" {
+		http.Error(w, "namespace is required", http.StatusBadRequest)
+		return
+	}
+	images := req.Images
+	if req.PodSpec != nil {
+		images = append(images, pods.Images(v1.Pod{Spec: *req.PodSpec})...)
+	}
+	if len(images) == 0 {
+		http.Error(w, "images or podSpec is required", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeCheck(user, req.Namespace); err != nil {
+		glog.Warningf("rejecting check request from %s by %s: %v", r.RemoteAddr, user.Username, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	resp, err := check(req.Namespace, images, req.PodSpec)
+	if err != nil {
+		glog.Errorf("error checking images %v in namespace %s: %v", images, req.Namespace, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.Errorf("error writing check response: %v", err)
+	}
+}
+
+// authenticateCheck authenticates the bearer token of a check request and returns its user
+func authenticateCheck(r *http.Request) (authenticationv1.UserInfo, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return authenticationv1.UserInfo{}, fmt.Errorf("a bearer token is required")
+	}
+	return admissionConfig.authenticate(strings.TrimPrefix(auth, "Bearer "))
+}
+
+// authorizeCheck checks that user may get the image security policies of namespace
+func authorizeCheck(user authenticationv1.UserInfo, namespace string) error {
+	return admissionConfig.authorize(user, authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "get",
+		Group:     kritisv1beta1.SchemeGroupVersion.Group,
+		Resource:  "imagesecuritypolicies",
+	})
+}
+
+// check reviews images against the policies of namespace, as reviewImages does,
+// without violation strategies, events or metrics
+func check(namespace string, images []string, spec *v1.PodSpec) (*CheckResponse, error) {
+	isps, err := admissionConfig.fetchImageSecurityPolicies(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image security policies: %v", err)
+	}
+	client, err := admissionConfig.fetchMetadataClient()
+	if err != nil {
+		client = metadata.Unavailable(fmt.Errorf("error getting metadata client: %v", err))
+	}
+	if options.ReviewTimeout > 0 {
+		client = metadata.WithDeadline(client, time.Now().Add(options.ReviewTimeout))
+	}
+	pod := &v1.Pod{}
+	if spec != nil {
+		pod.Spec = *spec
+	}
+	pod.Namespace = namespace
+	r := review.New(client, nil, securitypolicy.ValidateImageSecurityPolicy).WithFailurePolicy(options.FailurePolicy).DryRun()
+
+	resp := &CheckResponse{Allowed: true, Images: images, Policies: []string{}, Violations: []CheckViolation{}}
+	for _, isp := range isps {
+		resp.Policies = append(resp.Policies, securitypolicy.Name(isp))
+	}
+	err = r.Review(images, isps, pod)
+	verr, ok := err.(*review.ViolationError)
+	if !ok {
+		if err != nil {
+			resp.Allowed, resp.Message = false, err.Error()
+		}
+		return resp, nil
+	}
+	for _, v := range verr.Violations {
+		resp.Violations = append(resp.Violations, CheckViolation{
+			Image:     v.Image,
+			Policy:    v.Policy,
+			Action:    string(v.EnforcementAction),
+			Type:      securitypolicy.ViolationType(v.Violation),
+			CVE:       v.Vulnerability.CVE,
+			Severity:  v.Vulnerability.Severity,
+			CVSSScore: v.Vulnerability.CVSSScore,
+			Reason:    string(v.Reason),
+		})
+		if v.EnforcementAction == kritisv1beta1.EnforcementActionWarn {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("image security policy %s: %s", v.Policy, v.Reason))
+		}
+	}
+	for _, f := range verr.FailedOpen {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("image security policy %s failed open for %s: %v", f.Policy, f.Image, f.Err))
+	}
+	enforced := &review.ViolationError{Violations: verr.WithAction(kritisv1beta1.EnforcementActionEnforce)}
+	if len(enforced.Violations) != 0 {
+		resp.Allowed, resp.Message = false, enforced.Error()
+	}
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/testutil"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_CheckHandler(t *testing.T) {
+	isps := []kritisv1beta1.ImageSecurityPolicy{
+		{ObjectMeta: metav1.ObjectMeta{Name: "enforced"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "warned"},
+			Spec:       kritisv1beta1.ImageSecurityPolicySpec{EnforcementAction: kritisv1beta1.EnforcementActionWarn},
+		},
+	}
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		httpStatus int
+		allowed    bool
+		violations int
+	}{
+		{
+			name:       "qualified images",
+			token:      "ci",
+			body:       fmt.Sprintf(`{"namespace":"ns","images":[%q]}`, testutil.QualifiedImage),
+			httpStatus: http.StatusOK,
+			allowed:    true,
+		},
+		{
+			name:       "unqualified pod spec",
+			token:      "ci",
+			body:       `{"namespace":"ns","podSpec":{"containers":[{"name":"app","image":"image:tag"}]}}`,
+			httpStatus: http.StatusOK,
+			allowed:    false,
+			violations: 2,
+		},
+		{
+			name:       "no token",
+			body:       `{"namespace":"ns","images":["image:tag"]}`,
+			httpStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token",
+			token:      "invalid",
+			body:       `{"namespace":"ns","images":["image:tag"]}`,
+			httpStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no token with an invalid body",
+			body:       `{"namespace":`,
+			httpStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token without images",
+			token:      "invalid",
+			body:       `{"namespace":"ns"}`,
+			httpStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "forbidden namespace",
+			token:      "ci",
+			body:       `{"namespace":"other","images":["image:tag"]}`,
+			httpStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no images",
+			token:      "ci",
+			body:       `{"namespace":"ns"}`,
+			httpStatus: http.StatusBadRequest,
+		},
+	}
+	originalConfig := admissionConfig
+	defer func() {
+		admissionConfig = originalConfig
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := 0
+			admissionConfig = config{
+				fetchMetadataClient: func() (metadata.MetadataFetcher, error) {
+					return testutil.MockMetadataClient{}, nil
+				},
+				fetchImageSecurityPolicies: func(namespace string) ([]kritisv1beta1.ImageSecurityPolicy, error) {
+					return isps, nil
+				},
+				recordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+					events++
+					return nil
+				},
+				authenticate: func(token string) (authenticationv1.UserInfo, error) {
+					if token != "ci" {
+						return authenticationv1.UserInfo{}, fmt.Errorf("invalid token")
+					}
+					return authenticationv1.UserInfo{Username: "ci"}, nil
+				},
+				authorize: func(user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) error {
+					if attrs.Namespace != "ns" || attrs.Resource != "imagesecuritypolicies" {
+						return fmt.Errorf("forbidden")
+					}
+					return nil
+				},
+			}
+			req := httptest.NewRequest("POST", "/v1/check", bytes.NewReader([]byte(test.body)))
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rr := httptest.NewRecorder()
+			CheckHandler(rr, req)
+			if rr.Code != test.httpStatus {
+				t.Fatalf("got status %d, expected %d: %s", rr.Code, test.httpStatus, rr.Body.String())
+			}
+			if events != 0 {
+				t.Errorf("got %d events, expected none", events)
+			}
+			if test.httpStatus != http.StatusOK {
+				return
+			}
+			var resp CheckResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Allowed != test.allowed {
+				t.Errorf("got allowed %t, expected %t: %s", resp.Allowed, test.allowed, resp.Message)
+			}
+			if len(resp.Violations) != test.violations {
+				t.Errorf("got violations %v, expected %d", resp.Violations, test.violations)
+			}
+			if len(resp.Policies) != len(isps) {
+				t.Errorf("got policies %v, expected %d", resp.Policies, len(isps))
+			}
+		})
+	}
+}
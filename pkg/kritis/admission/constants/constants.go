@@ -30,6 +30,13 @@ const (
 	SuccessMessage = "Successfully admitted."
 )
 
+// Supported versions of the AdmissionReview API
+const (
+	AdmissionReviewKind = "AdmissionReview"
+	AdmissionV1         = "admission.k8s.io/v1"
+	AdmissionV1beta1    = "admission.k8s.io/v1beta1"
+)
+
 const (
 	RSABits = 4096
 )
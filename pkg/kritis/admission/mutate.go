@@ -0,0 +1,232 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/grafeas/kritis/pkg/kritis/kubectl/plugins/resolve"
+	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podSpecPaths is the JSON pointer to the pod spec of every kind the mutating webhook pins
+var podSpecPaths = map[string]string{
+	"Pod":                   "/spec",
+	"Deployment":            "/spec/template/spec",
+	"ReplicaSet":            "/spec/template/spec",
+	"StatefulSet":           "/spec/template/spec",
+	"DaemonSet":             "/spec/template/spec",
+	"ReplicationController": "/spec/template/spec",
+	"Job":                   "/spec/template/spec",
+	"CronJob":               "/spec/jobTemplate/spec/template/spec",
+}
+
+// patchOperation is a single RFC 6902 JSON patch operation
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MutatingAdmissionReviewHandler pins every image referenced by tag to its digest.
+// On updates only the images the update adds are pinned, so running containers
+// aren't restarted. It never denies a request: images it can't resolve are left
+// as they are, and are then rejected by the validating webhook.
+func MutatingAdmissionReviewHandler(w http.ResponseWriter, r *http.Request) {
+	ar, _, err := deserializeRequest(r)
+	if err != nil {
+		glog.Errorf("Error reading body: %v", err)
+		http.Error(w, "can't read body", http.StatusBadRequest)
+		return
+	}
+	apiVersion, err := admissionReviewVersion(ar)
+	if err != nil {
+		glog.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admitResponse := newAdmissionReview(apiVersion, ar.Request.UID)
+
+	path, ok := podSpecPaths[ar.Request.Kind.Kind]
+	if ar.Request.Kind.Kind == "EphemeralContainers" {
+		// The containers of the pods/ephemeralcontainers subresource are at its root
+		path, ok = "", true
+	}
+	if ok {
+		patch, err := resolveTagsPatch(ar.Request, path)
+		if err != nil {
+			glog.Errorf("error resolving tags for %s %s/%s: %v", ar.Request.Kind.Kind, ar.Request.Namespace, ar.Request.Name, err)
+		} else if len(patch) != 0 {
+			pt := v1beta1.PatchTypeJSONPatch
+			admitResponse.Response.Patch = patch
+			admitResponse.Response.PatchType = &pt
+		}
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	payload, err := json.Marshal(admitResponse)
+	if err != nil {
+		glog.Info(err)
+	}
+	w.Write(payload)
+}
+
+// resolveTagsPatch returns a JSON patch replacing each tagged image in the
+// pod spec found at path with its digest, or nil if there is nothing to replace.
+// Images that can't be resolved are skipped.
+func resolveTagsPatch(req *v1beta1.AdmissionRequest, path string) ([]byte, error) {
+	spec := &v1.PodSpec{}
+	if path != "" {
+		s, err := podSpecAt(req.Object.Raw, path)
+		if err != nil {
+			return nil, err
+		}
+		spec = s
+	} else {
+		// The pods/ephemeralcontainers subresource has no pod spec: the pull secrets are the target pod's
+		pod, err := admissionConfig.fetchPod(req.Namespace, req.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error getting pod %s/%s: %v", req.Namespace, req.Name, err)
+		}
+		spec.ImagePullSecrets = pod.Spec.ImagePullSecrets
+	}
+	ephemeral, err := ephemeralContainersAt(req.Object.Raw, path)
+	if err != nil {
+		return nil, err
+	}
+	var secretNames []string
+	for _, s := range spec.ImagePullSecrets {
+		secretNames = append(secretNames, s.Name)
+	}
+	keychain, err := admissionConfig.fetchPullSecrets(req.Namespace, secretNames)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image pull secrets: %v", err)
+	}
+
+	var images []string
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers, ephemeral} {
+		for _, c := range containers {
+			images = append(images, c.Image)
+		}
+	}
+	added := map[string]bool{}
+	for _, image := range changedImages(images, req) {
+		added[image] = true
+	}
+
+	resolved := map[string]string{}
+	var ops []patchOperation
+	addOps := func(field string, containers []v1.Container) {
+		for i, c := range containers {
+			if resolve.FullyQualifiedImage(c.Image) || !added[c.Image] {
+				continue
+			}
+			digest, ok := resolved[c.Image]
+			if !ok {
+				d, err := admissionConfig.resolveImage(c.Image, keychain)
+				if err != nil {
+					glog.Warningf("error resolving %s in %s %s/%s: %v", c.Image, req.Kind.Kind, req.Namespace, req.Name, err)
+					// Don't try again for the other containers using it
+					added[c.Image] = false
+					continue
+				}
+				glog.Infof("resolved %s to %s", c.Image, d)
+				resolved[c.Image] = d
+				digest = d
+			}
+			ops = append(ops, patchOperation{
+				Op:    "replace",
+				Path:  fmt.Sprintf("%s/%s/%d/image", path, field, i),
+				Value: digest,
+			})
+		}
+	}
+	addOps("initContainers", spec.InitContainers)
+	addOps("containers", spec.Containers)
+	addOps("ephemeralContainers", ephemeral)
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ops)
+}
+
+// ephemeralContainersAt decodes the ephemeral containers of the pod spec or
+// EphemeralContainers object found at the JSON pointer path of raw.
+// The vendored API types predate ephemeral containers.
+func ephemeralContainersAt(raw []byte, path string) ([]v1.Container, error) {
+	b, err := rawAt(raw, path+"/ephemeralContainers")
+	if err != nil {
+		return nil, err
+	}
+	var containers []v1.Container
+	if err := json.Unmarshal(b, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// podSpecAt decodes the pod spec found at the JSON pointer path of raw
+func podSpecAt(raw []byte, path string) (*v1.PodSpec, error) {
+	b, err := rawAt(raw, path)
+	if err != nil {
+		return nil, err
+	}
+	spec := v1.PodSpec{}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// rawAt returns the JSON value found at the JSON pointer path of raw
+func rawAt(raw []byte, path string) ([]byte, error) {
+	var obj interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s not found in object", path)
+		}
+		obj = m[key]
+	}
+	return json.Marshal(obj)
+}
+
+func pullSecretKeychain(namespace string, names []string) (authn.Keychain, error) {
+	return secrets.GetPullSecretKeychain(namespace, names)
+}
+
+func getPod(namespace, name string) (*v1.Pod, error) {
+	client, err := kubernetesutil.GetClientset()
+	if err != nil {
+		return nil, err
+	}
+	return client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/grafeas/kritis/pkg/kritis/testutil"
+	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_MutatingAdmissionReviewHandler(t *testing.T) {
+	podSpec := v1.PodSpec{
+		ImagePullSecrets: []v1.LocalObjectReference{{Name: "pull-secret"}},
+		InitContainers: []v1.Container{
+			{Image: "gcr.io/image/init:tag"},
+		},
+		Containers: []v1.Container{
+			{Image: testutil.QualifiedImage},
+			{Image: "gcr.io/image/tagged:tag"},
+		},
+	}
+	updated := podSpec
+	updated.Containers = []v1.Container{
+		{Image: testutil.QualifiedImage},
+		{Image: "gcr.io/image/updated:tag"},
+	}
+	ephemeralPod := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"imagePullSecrets":    podSpec.ImagePullSecrets,
+			"containers":          podSpec.Containers,
+			"ephemeralContainers": []v1.Container{{Image: "gcr.io/image/debug:tag"}},
+		},
+	}
+	tests := []struct {
+		name       string
+		kind       string
+		operation  v1beta1.Operation
+		object     interface{}
+		oldObject  interface{}
+		resolved   bool
+		unresolved string
+		expected   string
+	}{
+		{
+			name:     "pod",
+			kind:     "Pod",
+			object:   v1.Pod{Spec: podSpec},
+			resolved: true,
+			expected: `[{"op":"replace","path":"/spec/initContainers/0/image","value":"gcr.io/image/init@sha256:digest"},` +
+				`{"op":"replace","path":"/spec/containers/1/image","value":"gcr.io/image/tagged@sha256:digest"}]`,
+		},
+		{
+			name:     "deployment",
+			kind:     "Deployment",
+			object:   appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: podSpec}}},
+			resolved: true,
+			expected: `[{"op":"replace","path":"/spec/template/spec/initContainers/0/image","value":"gcr.io/image/init@sha256:digest"},` +
+				`{"op":"replace","path":"/spec/template/spec/containers/1/image","value":"gcr.io/image/tagged@sha256:digest"}]`,
+		},
+		{
+			name:       "one image can't be resolved",
+			kind:       "Pod",
+			object:     v1.Pod{Spec: podSpec},
+			resolved:   true,
+			unresolved: "gcr.io/image/init:tag",
+			expected:   `[{"op":"replace","path":"/spec/containers/1/image","value":"gcr.io/image/tagged@sha256:digest"}]`,
+		},
+		{
+			name:      "update pins only the changed image",
+			kind:      "Deployment",
+			operation: v1beta1.Update,
+			object:    appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: updated}}},
+			oldObject: appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: podSpec}}},
+			resolved:  true,
+			expected:  `[{"op":"replace","path":"/spec/template/spec/containers/1/image","value":"gcr.io/image/updated@sha256:digest"}]`,
+		},
+		{
+			name:     "pod with ephemeral containers",
+			kind:     "Pod",
+			object:   ephemeralPod,
+			resolved: true,
+			expected: `[{"op":"replace","path":"/spec/containers/1/image","value":"gcr.io/image/tagged@sha256:digest"},` +
+				`{"op":"replace","path":"/spec/ephemeralContainers/0/image","value":"gcr.io/image/debug@sha256:digest"}]`,
+		},
+		{
+			name: "ephemeral containers subresource",
+			kind: "EphemeralContainers",
+			object: map[string]interface{}{
+				"ephemeralContainers": []v1.Container{{Image: "gcr.io/image/debug:tag"}},
+			},
+			resolved: true,
+			expected: `[{"op":"replace","path":"/ephemeralContainers/0/image","value":"gcr.io/image/debug@sha256:digest"}]`,
+		},
+		{
+			name:     "resolution error",
+			kind:     "Pod",
+			object:   v1.Pod{Spec: podSpec},
+			resolved: false,
+		},
+		{
+			name:     "unsupported kind",
+			kind:     "Service",
+			object:   v1.Service{},
+			resolved: true,
+		},
+	}
+	original := admissionConfig
+	defer func() {
+		admissionConfig = original
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			admissionConfig = config{
+				fetchPullSecrets: func(namespace string, names []string) (authn.Keychain, error) {
+					if len(names) != 1 || names[0] != "pull-secret" {
+						t.Errorf("unexpected pull secrets %v", names)
+					}
+					return authn.DefaultKeychain, nil
+				},
+				fetchPod: func(namespace, name string) (*v1.Pod, error) {
+					if test.kind != "EphemeralContainers" {
+						t.Errorf("unexpected lookup of pod %s/%s", namespace, name)
+					}
+					if namespace != "ns" || name != "debugged" {
+						return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+					}
+					return &v1.Pod{Spec: podSpec}, nil
+				},
+				resolveImage: func(image string, keychain authn.Keychain) (string, error) {
+					if !test.resolved || image == test.unresolved {
+						return "", fmt.Errorf("can't resolve %s", image)
+					}
+					return image[:len(image)-len(":tag")] + "@sha256:digest", nil
+				},
+			}
+			raw, err := json.Marshal(test.object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var oldRaw []byte
+			if test.oldObject != nil {
+				if oldRaw, err = json.Marshal(test.oldObject); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ar := v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Kind:      metav1.GroupVersionKind{Kind: test.kind},
+					Namespace: "ns",
+					Name:      "debugged",
+					Operation: test.operation,
+					Object:    runtime.RawExtension{Raw: raw},
+					OldObject: runtime.RawExtension{Raw: oldRaw},
+				},
+			}
+			body, err := json.Marshal(ar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			MutatingAdmissionReviewHandler(rr, httptest.NewRequest("POST", "/mutate", bytes.NewReader(body)))
+			response := v1beta1.AdmissionReview{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !response.Response.Allowed {
+				t.Errorf("mutating webhook should always allow the request")
+			}
+			if string(response.Response.Patch) != test.expected {
+				t.Errorf("got patch %s, expected %s", response.Response.Patch, test.expected)
+			}
+			if (response.Response.PatchType != nil) != (test.expected != "") {
+				t.Errorf("unexpected patch type %v", response.Response.PatchType)
+			}
+		})
+	}
+}
@@ -49,6 +49,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&ImageSecurityPolicyList{},
 		&AttestationAuthority{},
 		&AttestationAuthorityList{},
+		&ClusterImageSecurityPolicy{},
+		&ClusterImageSecurityPolicyList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
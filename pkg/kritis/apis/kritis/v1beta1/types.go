@@ -17,6 +17,9 @@ limitations under the License.
 package v1beta1
 
 import (
+	"encoding/json"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -34,15 +37,129 @@ type ImageSecurityPolicy struct {
 
 // PackageVulnerabilityRequirements is the requirements for package vulnz for an ImageSecurityPolicy
 type PackageVulnerabilityRequirements struct {
-	MaximumSeverity       string   `json:"maximumSeverity"`
-	OnlyFixesNotAvailable bool     `json:"onlyFixesNotAvailable"`
-	WhitelistCVEs         []string `json:"whitelistCVEs"`
+	MaximumSeverity       string         `json:"maximumSeverity"`
+	OnlyFixesNotAvailable bool           `json:"onlyFixesNotAvailable"`
+	WhitelistCVEs         []WhitelistCVE `json:"whitelistCVEs"`
+	// MaximumCVSSScore is the highest CVSS base score allowed, vulnerabilities without a score aren't checked against it
+	MaximumCVSSScore *float64 `json:"maximumCvssScore,omitempty"`
+	// SeverityBudgets limit how many CVEs of a severity an image may have
+	SeverityBudgets []SeverityBudget `json:"severityBudgets,omitempty"`
+	// RemediationWindows are grace periods to remediate vulnerabilities in, before they violate the policy
+	RemediationWindows []RemediationWindow `json:"remediationWindows,omitempty"`
+	// PackageExceptions ignore vulnerabilities of specific packages
+	PackageExceptions []PackageException `json:"packageExceptions,omitempty"`
+}
+
+// SeverityBudget limits how many CVEs of a severity an image may have, in total,
+// with fixes available, or without. Unset limits are unlimited.
+type SeverityBudget struct {
+	Severity     string `json:"severity"`
+	Max          *int   `json:"max,omitempty"`
+	MaxFixable   *int   `json:"maxFixable,omitempty"`
+	MaxUnfixable *int   `json:"maxUnfixable,omitempty"`
+}
+
+// RemediationWindow is a grace period during which vulnerabilities of a severity don't violate the policy.
+// Vulnerabilities without a grace period violate the policy as soon as they are found.
+type RemediationWindow struct {
+	Severity string `json:"severity"`
+	// Unfixable is the grace period of vulnerabilities without a fix available,
+	// from when they were first seen on the image
+	Unfixable *metav1.Duration `json:"unfixable,omitempty"`
+	// Fixable is the grace period of vulnerabilities with a fix available,
+	// from when the fix became available
+	Fixable *metav1.Duration `json:"fixable,omitempty"`
+}
+
+// PackageException ignores vulnerabilities in a package, all of them or only some CVEs,
+// in all versions of the package or only a range of them.
+type PackageException struct {
+	Package string `json:"package"`
+	// CVEs are the ignored CVEs, all CVEs of the package are ignored if empty
+	CVEs []string `json:"cves,omitempty"`
+	// VersionAtLeast is the lowest version of the package which is ignored
+	VersionAtLeast string `json:"versionAtLeast,omitempty"`
+	// VersionBelow is the lowest version of the package which is no longer ignored
+	VersionBelow  string `json:"versionBelow,omitempty"`
+	Justification string `json:"justification,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	// Expiry is when the exception stops applying, it never does if unset
+	Expiry *metav1.Time `json:"expiry,omitempty"`
+}
+
+// Expired returns true if the exception has an expiry which isn't after t
+func (e PackageException) Expired(t time.Time) bool {
+	return e.Expiry != nil && !t.Before(e.Expiry.Time)
+}
+
+// WhitelistCVE is a CVE which is ignored by an ImageSecurityPolicy, with a record of why.
+// Entries with only a CVE are written as a plain string.
+type WhitelistCVE struct {
+	CVE           string `json:"cve"`
+	Justification string `json:"justification,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	// Expiry is when the CVE stops being ignored, it never does if unset
+	Expiry *metav1.Time `json:"expiry,omitempty"`
 }
 
+// Expired returns true if the entry has an expiry which isn't after t
+func (w WhitelistCVE) Expired(t time.Time) bool {
+	return w.Expiry != nil && !t.Before(w.Expiry.Time)
+}
+
+// whitelistCVE has the fields of WhitelistCVE without its JSON methods
+type whitelistCVE WhitelistCVE
+
+func (w WhitelistCVE) MarshalJSON() ([]byte, error) {
+	if w == (WhitelistCVE{CVE: w.CVE}) {
+		return json.Marshal(w.CVE)
+	}
+	return json.Marshal(whitelistCVE(w))
+}
+
+func (w *WhitelistCVE) UnmarshalJSON(b []byte) error {
+	var cve string
+	if err := json.Unmarshal(b, &cve); err == nil {
+		*w = WhitelistCVE{CVE: cve}
+		return nil
+	}
+	var e whitelistCVE
+	if err := json.Unmarshal(b, &e); err != nil {
+		return err
+	}
+	*w = WhitelistCVE(e)
+	return nil
+}
+
+// EnforcementAction defines what happens when an image violates an ImageSecurityPolicy
+type EnforcementAction string
+
+const (
+	// EnforcementActionEnforce denies objects with images in violation. This is the default.
+	EnforcementActionEnforce EnforcementAction = "enforce"
+	// EnforcementActionWarn admits objects with images in violation, and returns warnings to the client.
+	EnforcementActionWarn EnforcementAction = "warn"
+	// EnforcementActionAudit admits objects with images in violation, and only records the violations.
+	EnforcementActionAudit EnforcementAction = "audit"
+)
+
+// FailurePolicy defines what happens when the metadata backend can't be used to review an image
+type FailurePolicy string
+
+const (
+	// FailurePolicyClosed denies objects whose images can't be reviewed.
+	FailurePolicyClosed FailurePolicy = "closed"
+	// FailurePolicyOpen admits objects whose images can't be reviewed.
+	FailurePolicyOpen FailurePolicy = "open"
+)
+
 // ImageSecurityPolicy is the spec for a ImageSecurityPolicy resource
 type ImageSecurityPolicySpec struct {
 	ImageWhitelist                   []string                         `json:"imageWhitelist"`
 	PackageVulnerabilityRequirements PackageVulnerabilityRequirements `json:"packageVulnerabilityRequirements"`
+	EnforcementAction                EnforcementAction                `json:"enforcementAction,omitempty"`
+	// FailurePolicy overrides the cluster wide failure policy of the admission webhook
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -55,6 +172,39 @@ type ImageSecurityPolicyList struct {
 	Items []ImageSecurityPolicy `json:"items"`
 }
 
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterImageSecurityPolicy is a cluster wide ImageSecurityPolicy, which applies
+// to every namespace selected by its namespace selector. It's combined additively
+// with the ImageSecurityPolicies of a namespace: neither overrides the other.
+type ClusterImageSecurityPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterImageSecurityPolicySpec `json:"spec"`
+}
+
+// ClusterImageSecurityPolicySpec is the spec for a ClusterImageSecurityPolicy resource
+type ClusterImageSecurityPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to, all of them if unset
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	ImageSecurityPolicySpec `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterImageSecurityPolicyList is a list of ClusterImageSecurityPolicy resources
+type ClusterImageSecurityPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterImageSecurityPolicy `json:"items"`
+}
+
 // +genclient
 // +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
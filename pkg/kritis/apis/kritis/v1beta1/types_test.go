@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWhitelistCVEJSON(t *testing.T) {
+	// metav1.Time unmarshals times in the local time zone
+	expiry := metav1.NewTime(time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC).Local())
+	tests := []struct {
+		name     string
+		json     string
+		expected []WhitelistCVE
+	}{
+		{
+			name:     "plain strings",
+			json:     `["CVE-1","CVE-2"]`,
+			expected: []WhitelistCVE{{CVE: "CVE-1"}, {CVE: "CVE-2"}},
+		},
+		{
+			name:     "structured entry",
+			json:     `[{"cve":"CVE-1","justification":"not reachable","owner":"team@example.com","expiry":"2019-01-31T00:00:00Z"}]`,
+			expected: []WhitelistCVE{{CVE: "CVE-1", Justification: "not reachable", Owner: "team@example.com", Expiry: &expiry}},
+		},
+		{
+			name:     "mixed",
+			json:     `["CVE-1",{"cve":"CVE-2","owner":"team@example.com"}]`,
+			expected: []WhitelistCVE{{CVE: "CVE-1"}, {CVE: "CVE-2", Owner: "team@example.com"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual []WhitelistCVE
+			if err := json.Unmarshal([]byte(test.json), &actual); err != nil {
+				t.Fatalf("unmarshalling %s: %v", test.json, err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("got %+v, expected %+v", actual, test.expected)
+			}
+			b, err := json.Marshal(actual)
+			if err != nil {
+				t.Fatalf("marshalling %+v: %v", actual, err)
+			}
+			if string(b) != test.json {
+				t.Fatalf("got %s, expected %s", b, test.json)
+			}
+		})
+	}
+}
+
+func TestWhitelistCVEInvalid(t *testing.T) {
+	var w WhitelistCVE
+	if err := json.Unmarshal([]byte(`{"cve":"CVE-1","expiry":"tomorrow"}`), &w); err == nil {
+		t.Fatalf("expected an error for an invalid expiry, got %+v", w)
+	}
+}
@@ -21,6 +21,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -83,6 +84,88 @@ func (in *AttestationAuthorityList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterImageSecurityPolicy) DeepCopyInto(out *ClusterImageSecurityPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSecurityPolicy.
+func (in *ClusterImageSecurityPolicy) DeepCopy() *ClusterImageSecurityPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterImageSecurityPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterImageSecurityPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterImageSecurityPolicyList) DeepCopyInto(out *ClusterImageSecurityPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterImageSecurityPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSecurityPolicyList.
+func (in *ClusterImageSecurityPolicyList) DeepCopy() *ClusterImageSecurityPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterImageSecurityPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterImageSecurityPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterImageSecurityPolicySpec) DeepCopyInto(out *ClusterImageSecurityPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.ImageSecurityPolicySpec.DeepCopyInto(&out.ImageSecurityPolicySpec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSecurityPolicySpec.
+func (in *ClusterImageSecurityPolicySpec) DeepCopy() *ClusterImageSecurityPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterImageSecurityPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSecurityPolicy) DeepCopyInto(out *ImageSecurityPolicy) {
 	*out = *in
@@ -165,13 +248,66 @@ func (in *ImageSecurityPolicySpec) DeepCopy() *ImageSecurityPolicySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageException) DeepCopyInto(out *PackageException) {
+	*out = *in
+	if in.CVEs != nil {
+		in, out := &in.CVEs, &out.CVEs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Expiry != nil {
+		in, out := &in.Expiry, &out.Expiry
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageException.
+func (in *PackageException) DeepCopy() *PackageException {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageException)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PackageVulnerabilityRequirements) DeepCopyInto(out *PackageVulnerabilityRequirements) {
 	*out = *in
+	if in.MaximumCVSSScore != nil {
+		in, out := &in.MaximumCVSSScore, &out.MaximumCVSSScore
+		*out = new(float64)
+		**out = **in
+	}
 	if in.WhitelistCVEs != nil {
 		in, out := &in.WhitelistCVEs, &out.WhitelistCVEs
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+		*out = make([]WhitelistCVE, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SeverityBudgets != nil {
+		in, out := &in.SeverityBudgets, &out.SeverityBudgets
+		*out = make([]SeverityBudget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RemediationWindows != nil {
+		in, out := &in.RemediationWindows, &out.RemediationWindows
+		*out = make([]RemediationWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PackageExceptions != nil {
+		in, out := &in.PackageExceptions, &out.PackageExceptions
+		*out = make([]PackageException, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -185,3 +321,80 @@ func (in *PackageVulnerabilityRequirements) DeepCopy() *PackageVulnerabilityRequ
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemediationWindow) DeepCopyInto(out *RemediationWindow) {
+	*out = *in
+	if in.Unfixable != nil {
+		in, out := &in.Unfixable, &out.Unfixable
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Fixable != nil {
+		in, out := &in.Fixable, &out.Fixable
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemediationWindow.
+func (in *RemediationWindow) DeepCopy() *RemediationWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(RemediationWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SeverityBudget) DeepCopyInto(out *SeverityBudget) {
+	*out = *in
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxFixable != nil {
+		in, out := &in.MaxFixable, &out.MaxFixable
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxUnfixable != nil {
+		in, out := &in.MaxUnfixable, &out.MaxUnfixable
+		*out = new(int)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SeverityBudget.
+func (in *SeverityBudget) DeepCopy() *SeverityBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(SeverityBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WhitelistCVE) DeepCopyInto(out *WhitelistCVE) {
+	*out = *in
+	if in.Expiry != nil {
+		in, out := &in.Expiry, &out.Expiry
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WhitelistCVE.
+func (in *WhitelistCVE) DeepCopy() *WhitelistCVE {
+	if in == nil {
+		return nil
+	}
+	out := new(WhitelistCVE)
+	in.DeepCopyInto(out)
+	return out
+}
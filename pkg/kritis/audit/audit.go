@@ -0,0 +1,228 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes a hash chained log of the admission decisions of kritis.
+//
+// Each record holds the hash of the previous one, and its own hash covers its
+// contents and that previous hash. Modifying, removing or reordering records
+// breaks the chain, which Verify detects.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
+)
+
+// Image is an image reviewed, with its digest if it's referenced by one
+type Image struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// NewImage returns the Image of a reference, reading its digest if any
+func NewImage(image string) Image {
+	i := Image{Image: image}
+	if at := strings.LastIndex(image, "@"); at != -1 {
+		i.Digest = image[at+1:]
+	}
+	return i
+}
+
+// Violation is a violation of a policy by an image
+type Violation struct {
+	Image     string  `json:"image"`
+	Policy    string  `json:"policy"`
+	Action    string  `json:"action"`
+	Type      string  `json:"type"`
+	CVE       string  `json:"cve,omitempty"`
+	Severity  string  `json:"severity,omitempty"`
+	CVSSScore float64 `json:"cvssScore,omitempty"`
+	Reason    string  `json:"reason"`
+}
+
+// FailOpen is a policy which failed open for an image
+type FailOpen struct {
+	Image  string `json:"image"`
+	Policy string `json:"policy"`
+	Error  string `json:"error"`
+}
+
+// Record is the audit record of an admission decision
+type Record struct {
+	Time       time.Time   `json:"time"`
+	UID        string      `json:"uid"`
+	User       string      `json:"user"`
+	Groups     []string    `json:"groups,omitempty"`
+	Operation  string      `json:"operation"`
+	Kind       string      `json:"kind"`
+	Namespace  string      `json:"namespace"`
+	Name       string      `json:"name"`
+	Images     []Image     `json:"images,omitempty"`
+	Policies   []string    `json:"policies,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+	FailedOpen []FailOpen  `json:"failedOpen,omitempty"`
+	// Breakglass is the justification of the breakglass which admitted the object
+	Breakglass string   `json:"breakglass,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+	Outcome    string   `json:"outcome"`
+	Message    string   `json:"message,omitempty"`
+	// Dropped is the number of records dropped since the previous one, because the queue was full
+	Dropped int64 `json:"dropped,omitempty"`
+	// PrevHash is the hash of the previous record, empty for the first one
+	PrevHash string `json:"prevHash"`
+	// Hash is the SHA-256 of the record serialized with an empty hash
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of r, which covers r.PrevHash
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// QueueSize is the number of records a Logger queues for its sinks before dropping them
+const QueueSize = 1000
+
+// Logger chains records and writes them to its sinks, in order and in the background.
+// Logging never waits for the sinks: records are dropped when the queue is full.
+type Logger struct {
+	sinks   []Sink
+	records chan Record
+	done    chan struct{}
+	// dropped is the number of records dropped since the last one written
+	dropped int64
+	// last is the hash of the last record written, only used by the writer
+	last string
+}
+
+// NewLogger returns a Logger writing to sinks. The chain is resumed from the
+// last record of the first sink which implements Resumer.
+func NewLogger(sinks ...Sink) (*Logger, error) {
+	l := &Logger{
+		sinks:   sinks,
+		records: make(chan Record, QueueSize),
+		done:    make(chan struct{}),
+	}
+	for _, s := range sinks {
+		if r, ok := s.(Resumer); ok {
+			last, err := r.LastHash()
+			if err != nil {
+				return nil, err
+			}
+			l.last = last
+			break
+		}
+	}
+	go l.write()
+	return l, nil
+}
+
+// Log queues r for the sinks, where it's chained to the previous record.
+// It returns an error without waiting if the queue is full.
+func (l *Logger) Log(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	select {
+	case l.records <- r:
+		return nil
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+		metrics.RecordAuditDropped()
+		return fmt.Errorf("audit queue full, dropped record")
+	}
+}
+
+// Close writes the records queued and stops the Logger
+func (l *Logger) Close() {
+	close(l.records)
+	<-l.done
+}
+
+func (l *Logger) write() {
+	defer close(l.done)
+	for r := range l.records {
+		b, err := l.chain(r)
+		if err != nil {
+			glog.Errorf("error chaining audit record of %s %s/%s: %v", r.Kind, r.Namespace, r.Name, err)
+			continue
+		}
+		for _, s := range l.sinks {
+			if err := s.Write(b); err != nil {
+				glog.Errorf("error writing audit record to %s: %v", s, err)
+			}
+		}
+	}
+}
+
+// chain links r to the last record written and returns it serialized
+func (l *Logger) chain(r Record) ([]byte, error) {
+	r.Dropped = atomic.SwapInt64(&l.dropped, 0)
+	r.PrevHash = l.last
+	hash, err := r.computeHash()
+	if err != nil {
+		return nil, err
+	}
+	r.Hash = hash
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	l.last = hash
+	return b, nil
+}
+
+// Verify reads records, one per line, and checks that their hashes and the
+// chain between them are intact. The first record may continue an earlier chain.
+func Verify(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	prev := ""
+	for n := 1; scanner.Scan(); n++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		if n > 1 && rec.PrevHash != prev {
+			return fmt.Errorf("record %d: previous hash %s doesn't match record %d", n, rec.PrevHash, n-1)
+		}
+		hash, err := rec.computeHash()
+		if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		if hash != rec.Hash {
+			return fmt.Errorf("record %d: hash %s doesn't match its contents", n, rec.Hash)
+		}
+		prev = rec.Hash
+	}
+	return scanner.Err()
+}
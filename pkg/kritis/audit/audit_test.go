@@ -0,0 +1,184 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func logRecords(t *testing.T, sinks []Sink, names ...string) {
+	l, err := NewLogger(sinks...)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	for _, name := range names {
+		if err := l.Log(Record{Kind: "Pod", Namespace: "ns", Name: name, Outcome: "allowed"}); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+	l.Close()
+}
+
+func TestVerify(t *testing.T) {
+	var buf bytes.Buffer
+	logRecords(t, []Sink{NewWriterSink("buffer", &buf)}, "a", "b", "c")
+	log := buf.String()
+	if err := Verify(strings.NewReader(log)); err != nil {
+		t.Fatalf("Verify() error = %v for an intact log", err)
+	}
+	lines := strings.SplitAfter(log, "\n")
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"modified", strings.Replace(log, `"name":"b"`, `"name":"x"`, 1)},
+		{"removed", lines[0] + lines[2]},
+		{"reordered", lines[1] + lines[0] + lines[2]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(strings.NewReader(test.log)); err == nil {
+				t.Errorf("expected Verify() to fail for a %s record", test.name)
+			}
+		})
+	}
+}
+
+// blockingSink writes records to a WriterSink once unblocked
+type blockingSink struct {
+	*WriterSink
+	unblock chan struct{}
+}
+
+func (s blockingSink) Write(record []byte) error {
+	<-s.unblock
+	return s.WriterSink.Write(record)
+}
+
+func TestLogDropsWhenQueueFull(t *testing.T) {
+	var buf bytes.Buffer
+	s := blockingSink{WriterSink: NewWriterSink("buffer", &buf), unblock: make(chan struct{})}
+	l, err := NewLogger(s)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	dropped := 0
+	for i := 0; i < QueueSize+2; i++ {
+		if err := l.Log(Record{Kind: "Pod", Name: "a", Outcome: "allowed"}); err != nil {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Fatal("expected records to be dropped while the sink is blocked")
+	}
+	close(s.unblock)
+	l.Close()
+
+	var total int64
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("error reading record: %v", err)
+		}
+		total += r.Dropped
+		lines++
+	}
+	if lines+dropped != QueueSize+2 {
+		t.Errorf("got %d records written and %d dropped, expected %d in total", lines, dropped, QueueSize+2)
+	}
+	// Every drop happens before the second record is chained
+	if total != int64(dropped) {
+		t.Errorf("records report %d dropped, expected %d", total, dropped)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestFileSinkResumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	for _, name := range []string{"a", "b"} {
+		s, err := NewSink("file:" + path)
+		if err != nil {
+			t.Fatalf("NewSink() error = %v", err)
+		}
+		logRecords(t, []Sink{s}, name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Verify(f); err != nil {
+		t.Errorf("Verify() error = %v across restarts", err)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer server.Close()
+	s, err := NewSink(server.URL)
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	logRecords(t, []Sink{s}, "a", "b")
+	if len(bodies) != 2 {
+		t.Fatalf("got %d records posted, expected 2", len(bodies))
+	}
+	if err := Verify(strings.NewReader(strings.Join(bodies, "\n"))); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	if _, err := NewSink("stdout"); err != nil {
+		t.Errorf("NewSink(stdout) error = %v", err)
+	}
+	if _, err := NewSink("syslog"); err == nil {
+		t.Error("expected an error for an unknown sink")
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	i := NewImage("gcr.io/foo/bar@sha256:abc")
+	if i.Digest != "sha256:abc" {
+		t.Errorf("got digest %q, expected sha256:abc", i.Digest)
+	}
+	if i := NewImage("gcr.io/foo/bar:tag"); i.Digest != "" {
+		t.Errorf("got digest %q for a tag, expected none", i.Digest)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sink receives serialized audit records
+type Sink interface {
+	Write(record []byte) error
+}
+
+// Resumer is a Sink which persists records, so that the chain can be resumed
+type Resumer interface {
+	// LastHash returns the hash of the last record written, if any
+	LastHash() (string, error)
+}
+
+// NewSink returns the sink of spec, which is stdout, file:<path> or an http(s) URL
+func NewSink(spec string) (Sink, error) {
+	switch {
+	case spec == "stdout":
+		return NewWriterSink("stdout", os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileSink(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTPSink(spec), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q, must be stdout, file:<path> or an http(s) URL", spec)
+}
+
+// WriterSink writes records to an io.Writer, one per line
+type WriterSink struct {
+	name string
+	w    io.Writer
+}
+
+// NewWriterSink returns a sink named name writing to w
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+func (s *WriterSink) Write(record []byte) error {
+	_, err := s.w.Write(append(record, '\n'))
+	return err
+}
+
+func (s *WriterSink) String() string {
+	return s.name
+}
+
+// FileSink appends records to a file, one per line
+type FileSink struct {
+	path string
+	f    *os.File
+}
+
+// NewFileSink returns a sink appending to path, which is created if needed
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, f: f}, nil
+}
+
+func (s *FileSink) Write(record []byte) error {
+	_, err := s.f.Write(append(record, '\n'))
+	return err
+}
+
+// LastHash returns the hash of the last record of the file
+func (s *FileSink) LastHash() (string, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var last []byte
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) != 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil || last == nil {
+		return "", err
+	}
+	var rec Record
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return "", fmt.Errorf("reading last audit record of %s: %v", s.path, err)
+	}
+	return rec.Hash, nil
+}
+
+func (s *FileSink) String() string {
+	return "file:" + s.path
+}
+
+// HTTPSink posts each record to a URL
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink posting records to url
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Write(record []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(record))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *HTTPSink) String() string {
+	return s.url
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakglass
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/constants"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Breakglass allows an object to bypass image security policies.
+type Breakglass struct {
+	// Justification is the value of the breakglass annotation
+	Justification string
+	// Expiry is the time after which the breakglass no longer applies, if any
+	Expiry *time.Time
+}
+
+// Get returns the breakglass carried by meta, or nil if it has none.
+// A breakglass without a justification or with a malformed expiry is an error.
+func Get(meta metav1.ObjectMeta) (*Breakglass, error) {
+	justification, ok := meta.GetAnnotations()[constants.Breakglass]
+	if !ok {
+		return nil, nil
+	}
+	justification = strings.TrimSpace(justification)
+	// "true" was the only value documented before a justification was required
+	if justification == "" || justification == "true" {
+		return nil, fmt.Errorf("%s annotation must contain a justification", constants.Breakglass)
+	}
+	b := &Breakglass{Justification: justification}
+	if expiry, ok := meta.GetAnnotations()[constants.BreakglassExpiry]; ok {
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation must be an RFC 3339 timestamp: %v", constants.BreakglassExpiry, err)
+		}
+		b.Expiry = &t
+	}
+	return b, nil
+}
+
+// Has returns true if meta carries a breakglass annotation, valid or not.
+func Has(meta metav1.ObjectMeta) bool {
+	_, ok := meta.GetAnnotations()[constants.Breakglass]
+	return ok
+}
+
+// Changed returns true if the breakglass annotations of meta differ from those of old.
+func Changed(old, meta metav1.ObjectMeta) bool {
+	for _, a := range []string{constants.Breakglass, constants.BreakglassExpiry} {
+		if old.GetAnnotations()[a] != meta.GetAnnotations()[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns true if the breakglass no longer applies at now.
+func (b *Breakglass) Expired(now time.Time) bool {
+	return b.Expiry != nil && now.After(*b.Expiry)
+}
+
+// Controllers are the users of the built-in workload controllers. They create pods,
+// jobs and replica sets with the breakglass of the pod template of their owner,
+// which was authorized when the owner was admitted, so they may always use a breakglass.
+var Controllers = []string{
+	"system:kube-controller-manager",
+	"system:serviceaccount:kube-system:cronjob-controller",
+	"system:serviceaccount:kube-system:daemon-set-controller",
+	"system:serviceaccount:kube-system:deployment-controller",
+	"system:serviceaccount:kube-system:job-controller",
+	"system:serviceaccount:kube-system:replicaset-controller",
+	"system:serviceaccount:kube-system:replication-controller",
+	"system:serviceaccount:kube-system:statefulset-controller",
+}
+
+// Requesters are the users and groups allowed to use a breakglass, in addition to the Controllers.
+// Anyone may use a breakglass if both lists are empty.
+type Requesters struct {
+	Users  []string
+	Groups []string
+}
+
+// Allowed returns true if user is one of the requesters or belongs to one of their groups.
+func (r Requesters) Allowed(user authenticationv1.UserInfo) bool {
+	if len(r.Users) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+	for _, u := range Controllers {
+		if u == user.Username {
+			return true
+		}
+	}
+	for _, u := range r.Users {
+		if u == user.Username {
+			return true
+		}
+	}
+	for _, g := range r.Groups {
+		for _, ug := range user.Groups {
+			if g == ug {
+				return true
+			}
+		}
+	}
+	return false
+}
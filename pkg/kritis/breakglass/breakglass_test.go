@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakglass
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGet(t *testing.T) {
+	expiry := time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *Breakglass
+		shouldErr   bool
+	}{
+		{"no annotation", nil, nil, false},
+		{"empty justification", map[string]string{"kritis.grafeas.io/breakglass": " "}, nil, true},
+		{"legacy value", map[string]string{"kritis.grafeas.io/breakglass": "true"}, nil, true},
+		{"justification", map[string]string{"kritis.grafeas.io/breakglass": "hotfix"}, &Breakglass{Justification: "hotfix"}, false},
+		{"expiry", map[string]string{"kritis.grafeas.io/breakglass": "hotfix", "kritis.grafeas.io/breakglass-expiry": "2018-08-01T12:00:00Z"}, &Breakglass{Justification: "hotfix", Expiry: &expiry}, false},
+		{"invalid expiry", map[string]string{"kritis.grafeas.io/breakglass": "hotfix", "kritis.grafeas.io/breakglass-expiry": "2018-08-01"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := Get(metav1.ObjectMeta{Annotations: test.annotations})
+			if (err != nil) != test.shouldErr {
+				t.Fatalf("got error %v, expected error %t", err, test.shouldErr)
+			}
+			if (b == nil) != (test.expected == nil) {
+				t.Fatalf("got %v, expected %v", b, test.expected)
+			}
+			if b == nil {
+				return
+			}
+			if b.Justification != test.expected.Justification {
+				t.Errorf("got justification %s, expected %s", b.Justification, test.expected.Justification)
+			}
+			if (b.Expiry == nil) != (test.expected.Expiry == nil) || (b.Expiry != nil && !b.Expiry.Equal(*test.expected.Expiry)) {
+				t.Errorf("got expiry %v, expected %v", b.Expiry, test.expected.Expiry)
+			}
+			if b.Expired(expiry.Add(-time.Second)) {
+				t.Errorf("breakglass expired before its expiry")
+			}
+			if b.Expired(expiry.Add(time.Second)) != (b.Expiry != nil) {
+				t.Errorf("unexpected expiry after %v", expiry)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certs serves TLS certificates which are reloaded when their files change.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
+)
+
+// Reloader holds a TLS key pair, which is swapped when its files change
+type Reloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Value // *tls.Certificate
+
+	// mu guards the contents of the files last loaded
+	mu      sync.Mutex
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// NewReloader returns a Reloader for the key pair in certFile and keyFile,
+// which must be valid
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the key pair if its files changed since it was last loaded, and
+// returns whether it did. The previous key pair is kept on error.
+func (r *Reloader) Reload() (bool, error) {
+	certPEM, err := ioutil.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := ioutil.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return false, err
+	}
+	r.cert.Store(&cert)
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+	glog.Infof("loaded serving certificate %s, expiring at %s", r.certFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	metrics.RecordServingCertificateExpiry(cert.Leaf.NotAfter)
+	return true, nil
+}
+
+// GetCertificate returns the key pair last loaded, for tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+// Expiry returns when the certificate last loaded expires
+func (r *Reloader) Expiry() time.Time {
+	return r.cert.Load().(*tls.Certificate).Leaf.NotAfter
+}
+
+// Watch reloads the key pair every interval, until ctx is done.
+// Mounted secrets are updated by swapping a symlink, which can't be reliably
+// watched through file system notifications, so the files are polled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if _, err := r.Reload(); err != nil {
+				glog.Errorf("error reloading serving certificate %s, keeping the previous one: %v", r.certFile, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
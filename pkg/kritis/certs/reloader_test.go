@@ -0,0 +1,109 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self signed key pair expiring at notAfter
+func writeKeyPair(t *testing.T, dir string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kritis-validation-hook"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func writeFile(t *testing.T, file string, contents []byte) {
+	if err := ioutil.WriteFile(file, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	first := time.Now().Add(time.Hour).Truncate(time.Second)
+	writeKeyPair(t, dir, first)
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	if !r.Expiry().Equal(first) {
+		t.Errorf("got expiry %s, expected %s", r.Expiry(), first)
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("got Reload() = %t, %v for unchanged files, expected false, nil", reloaded, err)
+	}
+
+	second := first.Add(time.Hour)
+	writeKeyPair(t, dir, second)
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Errorf("got Reload() = %t, %v for rotated files, expected true, nil", reloaded, err)
+	}
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Leaf.NotAfter.Equal(second) {
+		t.Errorf("got served expiry %s, expected %s", cert.Leaf.NotAfter, second)
+	}
+
+	writeFile(t, keyFile, []byte("not a key"))
+	if reloaded, err := r.Reload(); reloaded || err == nil {
+		t.Errorf("got Reload() = %t, %v for an invalid key, expected an error", reloaded, err)
+	}
+	if !r.Expiry().Equal(second) {
+		t.Errorf("got expiry %s after an invalid key, expected the previous %s", r.Expiry(), second)
+	}
+
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
@@ -28,6 +28,7 @@ import (
 type KritisV1beta1Interface interface {
 	RESTClient() rest.Interface
 	AttestationAuthoritiesGetter
+	ClusterImageSecurityPoliciesGetter
 	ImageSecurityPoliciesGetter
 }
 
@@ -40,6 +41,10 @@ func (c *KritisV1beta1Client) AttestationAuthorities(namespace string) Attestati
 	return newAttestationAuthorities(c, namespace)
 }
 
+func (c *KritisV1beta1Client) ClusterImageSecurityPolicies() ClusterImageSecurityPolicyInterface {
+	return newClusterImageSecurityPolicies(c)
+}
+
 func (c *KritisV1beta1Client) ImageSecurityPolicies(namespace string) ImageSecurityPolicyInterface {
 	return newImageSecurityPolicies(c, namespace)
 }
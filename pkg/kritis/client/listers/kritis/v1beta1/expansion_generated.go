@@ -26,6 +26,10 @@ type AttestationAuthorityListerExpansion interface{}
 // AttestationAuthorityNamespaceLister.
 type AttestationAuthorityNamespaceListerExpansion interface{}
 
+// ClusterImageSecurityPolicyListerExpansion allows custom methods to be added to
+// ClusterImageSecurityPolicyLister.
+type ClusterImageSecurityPolicyListerExpansion interface{}
+
 // ImageSecurityPolicyListerExpansion allows custom methods to be added to
 // ImageSecurityPolicyLister.
 type ImageSecurityPolicyListerExpansion interface{}
@@ -24,8 +24,10 @@ const (
 	InvalidImageSecPolicy           = "kritis.grafeas.io/invalidImageSecPolicy"
 	InvalidImageSecPolicyLabelValue = "invalidImageSecPolicy"
 
-	// Breakglass is the key for the breakglass annotation
+	// Breakglass is the key for the breakglass annotation, whose value is its justification
 	Breakglass = "kritis.grafeas.io/breakglass"
+	// BreakglassExpiry is the key for the RFC 3339 timestamp after which a breakglass expires
+	BreakglassExpiry = "kritis.grafeas.io/breakglass-expiry"
 
 	// A list of label values
 	PreviouslyAttestedAnnotation = "Previously attested."
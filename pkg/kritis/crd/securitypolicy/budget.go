@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"fmt"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	ca "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// BudgetCount is the number of distinct CVEs of a severity, with and without fixes available
+type BudgetCount struct {
+	Fixable   int
+	Unfixable int
+}
+
+// exceededBudgets returns a violation for each budget exceeded by vulnz.
+// A CVE is counted once per image, as unfixable if any of its packages has no fix available.
+func exceededBudgets(image string, budgets []v1beta1.SeverityBudget, vulnz []metadata.Vulnerability) ([]SecurityPolicyViolation, error) {
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+	fixable := map[string]bool{}
+	severities := map[string]string{}
+	for _, v := range vulnz {
+		if f, ok := fixable[v.CVE]; ok {
+			fixable[v.CVE] = f && v.HasFixAvailable
+			continue
+		}
+		fixable[v.CVE] = v.HasFixAvailable
+		severities[v.CVE] = v.Severity
+	}
+	counts := map[string]BudgetCount{}
+	for cve, f := range fixable {
+		c := counts[severities[cve]]
+		if f {
+			c.Fixable++
+		} else {
+			c.Unfixable++
+		}
+		counts[severities[cve]] = c
+	}
+	var violations []SecurityPolicyViolation
+	for _, b := range budgets {
+		if _, ok := ca.VulnerabilityType_Severity_value[b.Severity]; !ok {
+			return nil, fmt.Errorf("invalid severity level in budget: %s", b.Severity)
+		}
+		c := counts[b.Severity]
+		if !exceeds(c.Fixable+c.Unfixable, b.Max) && !exceeds(c.Fixable, b.MaxFixable) && !exceeds(c.Unfixable, b.MaxUnfixable) {
+			continue
+		}
+		violations = append(violations, SecurityPolicyViolation{
+			Vulnerability: metadata.Vulnerability{Severity: b.Severity},
+			Violation:     ExceedsSeverityBudgetViolation,
+			Reason:        ExceedsSeverityBudgetViolationReason(image, b, c),
+		})
+	}
+	return violations, nil
+}
+
+// exceeds returns true if there's a limit and count is above it
+func exceeds(count int, limit *int) bool {
+	return limit != nil && count > *limit
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"testing"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/testutil"
+)
+
+func Test_SeverityBudgets(t *testing.T) {
+	limit := func(i int) *int { return &i }
+	vulnz := []metadata.Vulnerability{
+		{CVE: "c1", Severity: "CRITICAL", HasFixAvailable: true},
+		{CVE: "h1", Severity: "HIGH", HasFixAvailable: true},
+		{CVE: "h2", Severity: "HIGH", HasFixAvailable: true, Package: "a"},
+		// h2 is unfixable as one of its packages has no fix
+		{CVE: "h2", Severity: "HIGH", HasFixAvailable: false, Package: "b"},
+		{CVE: "h3", Severity: "HIGH", HasFixAvailable: false},
+		{CVE: "m1", Severity: "MEDIUM", HasFixAvailable: true},
+		{CVE: "m2", Severity: "MEDIUM", HasFixAvailable: true},
+	}
+	tests := []struct {
+		name     string
+		budgets  []v1beta1.SeverityBudget
+		expected []string
+		shdErr   bool
+	}{
+		{
+			name:    "within budgets",
+			budgets: []v1beta1.SeverityBudget{{Severity: "CRITICAL", Max: limit(1)}, {Severity: "HIGH", Max: limit(3)}},
+		},
+		{
+			name: "exceeded budgets",
+			budgets: []v1beta1.SeverityBudget{
+				{Severity: "CRITICAL", Max: limit(0)},
+				{Severity: "HIGH", Max: limit(3), MaxFixable: limit(0)},
+				{Severity: "MEDIUM", MaxUnfixable: limit(0)},
+			},
+			expected: []string{
+				"found 1 CRITICAL CVEs in image, 1 fixable and 0 unfixable, exceeding the CRITICAL budget: 1 against max 0",
+				"found 3 HIGH CVEs in image, 1 fixable and 2 unfixable, exceeding the HIGH budget: 3 against max 3, 1 against maxFixable 0",
+			},
+		},
+		{
+			name:    "unfixable",
+			budgets: []v1beta1.SeverityBudget{{Severity: "HIGH", MaxUnfixable: limit(1)}},
+			expected: []string{
+				"found 3 HIGH CVEs in image, 1 fixable and 2 unfixable, exceeding the HIGH budget: 2 against maxUnfixable 1",
+			},
+		},
+		{
+			name:    "no vulnerabilities of severity",
+			budgets: []v1beta1.SeverityBudget{{Severity: "LOW", Max: limit(0)}},
+		},
+		{
+			name:    "invalid severity",
+			budgets: []v1beta1.SeverityBudget{{Severity: "SEVERE", Max: limit(0)}},
+			shdErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations, err := exceededBudgets("image", test.budgets, vulnz)
+			var reasons []string
+			for _, v := range violations {
+				if v.Violation != ExceedsSeverityBudgetViolation {
+					t.Errorf("got violation %s, expected %s", ViolationType(v.Violation), ViolationType(ExceedsSeverityBudgetViolation))
+				}
+				reasons = append(reasons, string(v.Reason))
+			}
+			testutil.CheckErrorAndDeepEqual(t, test.shdErr, err, test.expected, reasons)
+		})
+	}
+}
+
+func Test_SeverityBudgetsOnly(t *testing.T) {
+	limit := func(i int) *int { return &i }
+	isp := v1beta1.ImageSecurityPolicy{
+		Spec: v1beta1.ImageSecurityPolicySpec{
+			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+				WhitelistCVEs:   []v1beta1.WhitelistCVE{{CVE: "h2"}},
+				SeverityBudgets: []v1beta1.SeverityBudget{{Severity: "HIGH", Max: limit(1)}},
+			},
+		},
+	}
+	mc := testutil.MockMetadataClient{
+		Vulnz: []metadata.Vulnerability{
+			{CVE: "c1", Severity: "CRITICAL"},
+			{CVE: "h1", Severity: "HIGH"},
+			{CVE: "h2", Severity: "HIGH"},
+		},
+	}
+	violations, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, mc)
+	if err != nil {
+		t.Fatalf("error validating isp: %v", err)
+	}
+	if violations != nil {
+		t.Fatalf("got unexpected violations: %v", violations)
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	clientset "github.com/grafeas/kritis/pkg/kritis/client/clientset/versioned"
+	listers "github.com/grafeas/kritis/pkg/kritis/client/listers/kritis/v1beta1"
+	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
+	"github.com/grafeas/kritis/pkg/kritis/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncTimeout is how long a lookup waits for the caches to sync after they're started
+const syncTimeout = 30 * time.Second
+
+// crdRetryInterval is how often a resource whose CRD isn't installed is listed again
+const crdRetryInterval = time.Minute
+
+// policyCache watches image security policies, cluster image security policies and
+// namespaces, so that reviews read them from memory instead of the API server
+type policyCache struct {
+	mu      sync.Mutex
+	started bool
+	kube    kubernetes.Interface
+
+	isps cache.SharedIndexInformer
+	// cisps is empty while the ClusterImageSecurityPolicy CRD isn't installed
+	cisps      cache.SharedIndexInformer
+	namespaces cache.SharedIndexInformer
+}
+
+var policies = &policyCache{}
+
+// Start starts the caches of policies and namespaces, which then run for the life of the process
+func Start() error {
+	return policies.start()
+}
+
+// Synced returns an error if the caches of policies and namespaces aren't started
+// or haven't synced yet. It doesn't wait for them, so that it can serve readiness probes.
+func Synced() error {
+	policies.mu.Lock()
+	defer policies.mu.Unlock()
+	if !policies.started {
+		return fmt.Errorf("the image security policy caches aren't started")
+	}
+	for _, i := range policies.informers() {
+		if !i.HasSynced() {
+			return fmt.Errorf("the image security policy caches haven't synced")
+		}
+	}
+	return nil
+}
+
+// Ready starts the caches of policies and namespaces if they aren't yet,
+// and returns an error if they haven't synced within the sync timeout
+func Ready() error {
+	if err := policies.start(); err != nil {
+		return err
+	}
+	return policies.synced()
+}
+
+// start creates the shared clients and informers, and runs the informers for the life of the process
+func (c *policyCache) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return nil
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("error building config: %v", err)
+	}
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error building clientset: %v", err)
+	}
+	kube, err := kubernetesutil.GetClientset()
+	if err != nil {
+		return err
+	}
+	kritis := client.KritisV1beta1().RESTClient()
+	namespaceIndex := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	c.isps = cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(kritis, "imagesecuritypolicies", metav1.NamespaceAll, fields.Everything()),
+		&v1beta1.ImageSecurityPolicy{}, 0, namespaceIndex)
+	c.cisps = cache.NewSharedIndexInformer(
+		optionalListWatch(cache.NewListWatchFromClient(kritis, "clusterimagesecuritypolicies", metav1.NamespaceAll, fields.Everything()),
+			&v1beta1.ClusterImageSecurityPolicyList{}),
+		&v1beta1.ClusterImageSecurityPolicy{}, 0, cache.Indexers{})
+	c.namespaces = cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(kube.CoreV1().RESTClient(), "namespaces", metav1.NamespaceAll, fields.Everything()),
+		&corev1.Namespace{}, 0, cache.Indexers{})
+	// Image whitelist patterns are compiled as policies load, rather than on every review,
+	// and released as they change or are deleted
+	compile := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { util.CompileImagePatterns(whitelist(obj)) },
+		UpdateFunc: func(old, obj interface{}) {
+			util.CompileImagePatterns(whitelist(obj))
+			util.ReleaseImagePatterns(whitelist(old))
+		},
+		DeleteFunc: func(obj interface{}) { util.ReleaseImagePatterns(whitelist(obj)) },
+	}
+	c.isps.AddEventHandler(compile)
+	c.cisps.AddEventHandler(compile)
+	for _, i := range c.informers() {
+		go i.Run(wait.NeverStop)
+	}
+	c.kube = kube
+	c.started = true
+	return nil
+}
+
+// optionalListWatch lists and watches resources whose CRD may not be installed yet, or may be
+// removed, as lw does. While the CRD isn't installed it lists empty, and lists again every
+// crdRetryInterval, so that resources are watched once it's installed without a restart.
+func optionalListWatch(lw *cache.ListWatch, empty runtime.Object) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := lw.List(options)
+			if apierrors.IsNotFound(err) {
+				glog.V(2).Infof("CRD isn't installed, listing again in %s: %v", crdRetryInterval, err)
+				return empty.DeepCopyObject(), nil
+			}
+			return list, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.Watch(options)
+			if !apierrors.IsNotFound(err) {
+				return w, err
+			}
+			// An idle watch which ends after the retry interval, so that the informer lists again
+			idle := watch.NewFake()
+			time.AfterFunc(crdRetryInterval, idle.Stop)
+			return idle, nil
+		},
+	}
+}
+
+// whitelist returns the image whitelist of an image security policy or cluster image security policy,
+// including those of deletions whose final state is unknown
+func whitelist(obj interface{}) []string {
+	switch p := obj.(type) {
+	case *v1beta1.ImageSecurityPolicy:
+		return p.Spec.ImageWhitelist
+	case *v1beta1.ClusterImageSecurityPolicy:
+		return p.Spec.ImageWhitelist
+	case cache.DeletedFinalStateUnknown:
+		return whitelist(p.Obj)
+	}
+	return nil
+}
+
+func (c *policyCache) informers() []cache.SharedIndexInformer {
+	return []cache.SharedIndexInformer{c.isps, c.cisps, c.namespaces}
+}
+
+// synced waits for the informers to sync, for up to the sync timeout
+func (c *policyCache) synced() error {
+	var hasSynced []cache.InformerSynced
+	for _, i := range c.informers() {
+		if !i.HasSynced() {
+			hasSynced = append(hasSynced, i.HasSynced)
+		}
+	}
+	if len(hasSynced) == 0 {
+		return nil
+	}
+	stop := make(chan struct{})
+	timer := time.AfterFunc(syncTimeout, func() { close(stop) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(stop, hasSynced...) {
+		return fmt.Errorf("timed out waiting for the image security policy caches to sync")
+	}
+	return nil
+}
+
+// cachedImageSecurityPolicies returns the ISPs in the specified namespace, or in all namespaces if it's empty
+func cachedImageSecurityPolicies(namespace string) ([]v1beta1.ImageSecurityPolicy, error) {
+	if err := Ready(); err != nil {
+		return nil, err
+	}
+	lister := listers.NewImageSecurityPolicyLister(policies.isps.GetIndexer())
+	var list []*v1beta1.ImageSecurityPolicy
+	var err error
+	if namespace == "" {
+		list, err = lister.List(labels.Everything())
+	} else {
+		list, err = lister.ImageSecurityPolicies(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing image security policies: %v", err)
+	}
+	isps := make([]v1beta1.ImageSecurityPolicy, 0, len(list))
+	for _, isp := range list {
+		isps = append(isps, *isp.DeepCopy())
+	}
+	sort.Slice(isps, func(i, j int) bool {
+		if isps[i].Namespace != isps[j].Namespace {
+			return isps[i].Namespace < isps[j].Namespace
+		}
+		return isps[i].Name < isps[j].Name
+	})
+	return isps, nil
+}
+
+// cachedClusterImageSecurityPolicies returns all ClusterImageSecurityPolicies,
+// or none while their CRD isn't installed
+func cachedClusterImageSecurityPolicies() ([]v1beta1.ClusterImageSecurityPolicy, error) {
+	if err := Ready(); err != nil {
+		return nil, err
+	}
+	list, err := listers.NewClusterImageSecurityPolicyLister(policies.cisps.GetIndexer()).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("error listing cluster image security policies: %v", err)
+	}
+	cisps := make([]v1beta1.ClusterImageSecurityPolicy, 0, len(list))
+	for _, cisp := range list {
+		cisps = append(cisps, *cisp.DeepCopy())
+	}
+	sort.Slice(cisps, func(i, j int) bool { return cisps[i].Name < cisps[j].Name })
+	return cisps, nil
+}
+
+// cachedNamespaces returns the specified namespace, or all namespaces if it's empty.
+// A namespace missing from the cache is read from the API server, so that the
+// cluster policies of a namespace created moments ago aren't skipped.
+func cachedNamespaces(namespace string) ([]corev1.Namespace, error) {
+	if err := Ready(); err != nil {
+		return nil, err
+	}
+	indexer := policies.namespaces.GetIndexer()
+	if namespace == "" {
+		var nss []corev1.Namespace
+		for _, obj := range indexer.List() {
+			nss = append(nss, *obj.(*corev1.Namespace).DeepCopy())
+		}
+		sort.Slice(nss, func(i, j int) bool { return nss[i].Name < nss[j].Name })
+		return nss, nil
+	}
+	obj, exists, err := indexer.GetByKey(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return []corev1.Namespace{*obj.(*corev1.Namespace).DeepCopy()}, nil
+	}
+	ns, err := policies.kube.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting namespace %s: %v", namespace, err)
+	}
+	return []corev1.Namespace{*ns}, nil
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// staticInformer returns a synced informer holding list
+func staticInformer(t *testing.T, list runtime.Object, obj runtime.Object, indexers cache.Indexers, stop chan struct{}) cache.SharedIndexInformer {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	i := cache.NewSharedIndexInformer(lw, obj, 0, indexers)
+	go i.Run(stop)
+	if !cache.WaitForCacheSync(stop, i.HasSynced) {
+		t.Fatal("informer didn't sync")
+	}
+	return i
+}
+
+// notFoundListWatch lists and watches a resource whose CRD isn't installed
+func notFoundListWatch() *cache.ListWatch {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kritis.grafeas.io", Resource: "clusterimagesecuritypolicies"}, "")
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return nil, notFound
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return nil, notFound
+		},
+	}
+}
+
+// notInstalledInformer returns a synced informer of cluster policies whose CRD isn't installed
+func notInstalledInformer(t *testing.T, stop chan struct{}) cache.SharedIndexInformer {
+	i := cache.NewSharedIndexInformer(optionalListWatch(notFoundListWatch(), &v1beta1.ClusterImageSecurityPolicyList{}),
+		&v1beta1.ClusterImageSecurityPolicy{}, 0, cache.Indexers{})
+	go i.Run(stop)
+	if !cache.WaitForCacheSync(stop, i.HasSynced) {
+		t.Fatal("informer didn't sync")
+	}
+	return i
+}
+
+func Test_optionalListWatch(t *testing.T) {
+	lw := optionalListWatch(notFoundListWatch(), &v1beta1.ClusterImageSecurityPolicyList{})
+	list, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing without the CRD: %v", err)
+	}
+	if l, ok := list.(*v1beta1.ClusterImageSecurityPolicyList); !ok || len(l.Items) != 0 {
+		t.Errorf("got %v, expected an empty list", list)
+	}
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil || w == nil {
+		t.Fatalf("got %v, %v, expected an idle watch without the CRD", w, err)
+	}
+	w.Stop()
+
+	installed := &v1beta1.ClusterImageSecurityPolicyList{Items: []v1beta1.ClusterImageSecurityPolicy{{ObjectMeta: metav1.ObjectMeta{Name: "baseline"}}}}
+	lw = optionalListWatch(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return installed, nil
+		},
+	}, &v1beta1.ClusterImageSecurityPolicyList{})
+	if list, err := lw.List(metav1.ListOptions{}); err != nil || list != installed {
+		t.Errorf("got %v, %v, expected the installed policies", list, err)
+	}
+}
+
+func Test_PolicyCache(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	original := policies
+	defer func() {
+		policies = original
+	}()
+	isp := func(namespace, name string) v1beta1.ImageSecurityPolicy {
+		return v1beta1.ImageSecurityPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	namespaceIndex := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	policies = &policyCache{
+		started: true,
+		isps: staticInformer(t, &v1beta1.ImageSecurityPolicyList{Items: []v1beta1.ImageSecurityPolicy{
+			isp("prod", "b"), isp("dev", "a"), isp("prod", "a"),
+		}}, &v1beta1.ImageSecurityPolicy{}, namespaceIndex, stop),
+		cisps: notInstalledInformer(t, stop),
+		namespaces: staticInformer(t, &corev1.NamespaceList{Items: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		}}, &corev1.Namespace{}, cache.Indexers{}, stop),
+	}
+
+	names := func(isps []v1beta1.ImageSecurityPolicy) []string {
+		var n []string
+		for _, isp := range isps {
+			n = append(n, isp.Namespace+"/"+isp.Name)
+		}
+		return n
+	}
+	all, err := cachedImageSecurityPolicies("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"dev/a", "prod/a", "prod/b"}; !reflect.DeepEqual(names(all), expected) {
+		t.Errorf("got %v, expected %v", names(all), expected)
+	}
+	prod, err := cachedImageSecurityPolicies("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"prod/a", "prod/b"}; !reflect.DeepEqual(names(prod), expected) {
+		t.Errorf("got %v, expected %v", names(prod), expected)
+	}
+
+	// The CRD of cluster policies isn't installed
+	cisps, err := cachedClusterImageSecurityPolicies()
+	if err != nil || len(cisps) != 0 {
+		t.Errorf("got %v, %v, expected no cluster policies", cisps, err)
+	}
+
+	nss, err := cachedNamespaces("")
+	if err != nil || len(nss) != 2 || nss[0].Name != "dev" || nss[1].Name != "prod" {
+		t.Errorf("got %v, %v, expected namespaces dev and prod", nss, err)
+	}
+	nss, err = cachedNamespaces("prod")
+	if err != nil || len(nss) != 1 || nss[0].Name != "prod" {
+		t.Errorf("got %v, %v, expected namespace prod", nss, err)
+	}
+}
+
+func Test_Synced(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	original := policies
+	defer func() {
+		policies = original
+	}()
+	policies = &policyCache{}
+	if err := Synced(); err == nil {
+		t.Errorf("expected an error before the caches are started")
+	}
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			<-stop
+			return &corev1.NamespaceList{}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	unsynced := cache.NewSharedIndexInformer(lw, &corev1.Namespace{}, 0, cache.Indexers{})
+	go unsynced.Run(stop)
+	policies = &policyCache{
+		started:    true,
+		isps:       staticInformer(t, &v1beta1.ImageSecurityPolicyList{}, &v1beta1.ImageSecurityPolicy{}, cache.Indexers{}, stop),
+		cisps:      notInstalledInformer(t, stop),
+		namespaces: unsynced,
+	}
+	if err := Synced(); err == nil {
+		t.Errorf("expected an error while a cache is syncing")
+	}
+	policies.namespaces = staticInformer(t, &corev1.NamespaceList{}, &corev1.Namespace{}, cache.Indexers{}, stop)
+	if err := Synced(); err != nil {
+		t.Errorf("unexpected error once synced: %v", err)
+	}
+}
+
+func Test_whitelist(t *testing.T) {
+	spec := v1beta1.ImageSecurityPolicySpec{ImageWhitelist: []string{"gcr.io/proj/*"}}
+	isp := &v1beta1.ImageSecurityPolicy{Spec: spec}
+	tests := []struct {
+		name     string
+		obj      interface{}
+		expected []string
+	}{
+		{"image security policy", isp, spec.ImageWhitelist},
+		{"cluster image security policy", &v1beta1.ClusterImageSecurityPolicy{Spec: v1beta1.ClusterImageSecurityPolicySpec{ImageSecurityPolicySpec: spec}}, spec.ImageWhitelist},
+		{"deleted in an unknown state", cache.DeletedFinalStateUnknown{Key: "ns/isp", Obj: isp}, spec.ImageWhitelist},
+		{"other object", &corev1.Namespace{}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := whitelist(test.obj); !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("got %v, expected %v", actual, test.expected)
+			}
+		})
+	}
+}
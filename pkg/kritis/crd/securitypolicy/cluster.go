@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"fmt"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterImageSecurityPolicyKind is the kind of policies which come from a ClusterImageSecurityPolicy
+const ClusterImageSecurityPolicyKind = "ClusterImageSecurityPolicy"
+
+// For testing
+var (
+	imageSecurityPolicies        = cachedImageSecurityPolicies
+	clusterImageSecurityPolicies = cachedClusterImageSecurityPolicies
+	namespaces                   = cachedNamespaces
+)
+
+// EffectivePolicies returns the ISPs in the specified namespace, followed by the
+// ClusterImageSecurityPolicies selecting it as ISPs of that namespace.
+// Pass in an empty string to get the policies of all namespaces.
+// Cluster and namespace policies are combined additively: an image has to satisfy
+// all of them, and no policy overrides or relaxes another.
+// Policies and namespaces are read from the informer caches, see Ready.
+func EffectivePolicies(namespace string) ([]v1beta1.ImageSecurityPolicy, error) {
+	isps, err := imageSecurityPolicies(namespace)
+	if err != nil {
+		return nil, err
+	}
+	cisps, err := clusterImageSecurityPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if len(cisps) == 0 {
+		return isps, nil
+	}
+	nss, err := namespaces(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range nss {
+		policies, err := ClusterPoliciesFor(cisps, ns)
+		if err != nil {
+			return nil, err
+		}
+		isps = append(isps, policies...)
+	}
+	return isps, nil
+}
+
+// ClusterPoliciesFor returns the ClusterImageSecurityPolicies selecting ns, as ISPs of ns.
+// A policy without a namespace selector selects every namespace.
+func ClusterPoliciesFor(cisps []v1beta1.ClusterImageSecurityPolicy, ns corev1.Namespace) ([]v1beta1.ImageSecurityPolicy, error) {
+	var isps []v1beta1.ImageSecurityPolicy
+	for _, cisp := range cisps {
+		selector := labels.Everything()
+		if cisp.Spec.NamespaceSelector != nil {
+			s, err := metav1.LabelSelectorAsSelector(cisp.Spec.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespace selector in cluster image security policy %s: %v", cisp.Name, err)
+			}
+			selector = s
+		}
+		if !selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		isp := v1beta1.ImageSecurityPolicy{
+			TypeMeta:   metav1.TypeMeta{Kind: ClusterImageSecurityPolicyKind, APIVersion: v1beta1.SchemeGroupVersion.String()},
+			ObjectMeta: *cisp.ObjectMeta.DeepCopy(),
+			Spec:       *cisp.Spec.ImageSecurityPolicySpec.DeepCopy(),
+		}
+		isp.Namespace = ns.Name
+		isps = append(isps, isp)
+	}
+	return isps, nil
+}
+
+// IsClusterPolicy returns true if isp comes from a ClusterImageSecurityPolicy
+func IsClusterPolicy(isp v1beta1.ImageSecurityPolicy) bool {
+	return isp.Kind == ClusterImageSecurityPolicyKind
+}
+
+// Name returns the name policy decisions about isp are reported under.
+// Policies from a ClusterImageSecurityPolicy are prefixed, so they can't be
+// confused with an ISP of the same name.
+func Name(isp v1beta1.ImageSecurityPolicy) string {
+	if IsClusterPolicy(isp) {
+		return "clusterimagesecuritypolicy/" + isp.Name
+	}
+	return isp.Name
+}
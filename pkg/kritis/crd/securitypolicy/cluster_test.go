@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ClusterPoliciesFor(t *testing.T) {
+	cisp := func(name string, selector *metav1.LabelSelector) v1beta1.ClusterImageSecurityPolicy {
+		return v1beta1.ClusterImageSecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1beta1.ClusterImageSecurityPolicySpec{
+				NamespaceSelector: selector,
+				ImageSecurityPolicySpec: v1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity: "MEDIUM",
+					},
+				},
+			},
+		}
+	}
+	prod := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}}
+	dev := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}}
+	envProd := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	tests := []struct {
+		name          string
+		cisps         []v1beta1.ClusterImageSecurityPolicy
+		ns            corev1.Namespace
+		expectedNames []string
+		shouldErr     bool
+	}{
+		{
+			name:          "no selector matches every namespace",
+			cisps:         []v1beta1.ClusterImageSecurityPolicy{cisp("baseline", nil)},
+			ns:            dev,
+			expectedNames: []string{"baseline"},
+		},
+		{
+			name:          "selector matches namespace",
+			cisps:         []v1beta1.ClusterImageSecurityPolicy{cisp("baseline", nil), cisp("prod", envProd)},
+			ns:            prod,
+			expectedNames: []string{"baseline", "prod"},
+		},
+		{
+			name:          "selector doesn't match namespace",
+			cisps:         []v1beta1.ClusterImageSecurityPolicy{cisp("baseline", nil), cisp("prod", envProd)},
+			ns:            dev,
+			expectedNames: []string{"baseline"},
+		},
+		{
+			name: "match expressions",
+			cisps: []v1beta1.ClusterImageSecurityPolicy{cisp("not-dev", &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "env", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"dev"}},
+				},
+			})},
+			ns:            prod,
+			expectedNames: []string{"not-dev"},
+		},
+		{
+			name: "invalid selector",
+			cisps: []v1beta1.ClusterImageSecurityPolicy{cisp("invalid", &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "env", Operator: "Near"},
+				},
+			})},
+			ns:        prod,
+			shouldErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isps, err := ClusterPoliciesFor(test.cisps, test.ns)
+			if (err != nil) != test.shouldErr {
+				t.Fatalf("expected error %v, got %v", test.shouldErr, err)
+			}
+			var names []string
+			for _, isp := range isps {
+				if isp.Namespace != test.ns.Name {
+					t.Errorf("expected %s to be in namespace %s, got %s", isp.Name, test.ns.Name, isp.Namespace)
+				}
+				if !IsClusterPolicy(isp) {
+					t.Errorf("expected %s to be a cluster policy", isp.Name)
+				}
+				if isp.Spec.PackageVulnerabilityRequirements.MaximumSeverity != "MEDIUM" {
+					t.Errorf("expected %s to keep its spec, got %v", isp.Name, isp.Spec)
+				}
+				names = append(names, isp.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedNames) {
+				t.Errorf("expected %v, got %v", test.expectedNames, names)
+			}
+		})
+	}
+}
+
+func Test_EffectivePolicies(t *testing.T) {
+	origISPs, origCISPs, origNamespaces := imageSecurityPolicies, clusterImageSecurityPolicies, namespaces
+	defer func() {
+		imageSecurityPolicies, clusterImageSecurityPolicies, namespaces = origISPs, origCISPs, origNamespaces
+	}()
+	imageSecurityPolicies = func(namespace string) ([]v1beta1.ImageSecurityPolicy, error) {
+		return []v1beta1.ImageSecurityPolicy{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "isp"}},
+		}, nil
+	}
+	clusterImageSecurityPolicies = func() ([]v1beta1.ClusterImageSecurityPolicy, error) {
+		return []v1beta1.ClusterImageSecurityPolicy{
+			{ObjectMeta: metav1.ObjectMeta{Name: "baseline"}},
+		}, nil
+	}
+	namespaces = func(namespace string) ([]corev1.Namespace, error) {
+		return []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		}, nil
+	}
+	isps, err := EffectivePolicies("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, isp := range isps {
+		names = append(names, isp.Namespace+"/"+Name(isp))
+	}
+	expected := []string{"prod/isp", "prod/clusterimagesecuritypolicy/baseline", "dev/clusterimagesecuritypolicy/baseline"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
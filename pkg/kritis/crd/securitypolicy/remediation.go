@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+)
+
+// remediationDeadline returns when the remediation window of a vulnerability runs out,
+// or the zero time if it has none.
+// Vulnerabilities without a fix available are given from when they were first seen on the image.
+// Vulnerabilities with a fix available are given from when their occurrence was last updated,
+// which is when the fix became available unless the occurrence has changed since,
+// and never from before they were first seen.
+func remediationDeadline(windows []v1beta1.RemediationWindow, v metadata.Vulnerability) time.Time {
+	for _, w := range windows {
+		if w.Severity != v.Severity {
+			continue
+		}
+		grace, start := w.Unfixable, v.CreateTime
+		if v.HasFixAvailable {
+			grace = w.Fixable
+			if v.UpdateTime.After(start) {
+				start = v.UpdateTime
+			}
+		}
+		if grace == nil || start.IsZero() {
+			return time.Time{}
+		}
+		return start.Add(grace.Duration)
+	}
+	return time.Time{}
+}
+
+// withRemediationDeadline adds when the remediation window ran out to the reason of a violation, if there's one
+func withRemediationDeadline(reason Violation, deadline time.Time) Violation {
+	if deadline.IsZero() {
+		return reason
+	}
+	return Violation(fmt.Sprintf("%s, and its remediation window ran out at %s", reason, deadline.UTC().Format(time.RFC3339)))
+}
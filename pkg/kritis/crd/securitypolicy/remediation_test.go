@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RemediationWindows(t *testing.T) {
+	now := time.Now()
+	days := func(d int) *metav1.Duration { return &metav1.Duration{Duration: time.Duration(d) * 24 * time.Hour} }
+	windows := []v1beta1.RemediationWindow{
+		{Severity: "HIGH", Fixable: days(14), Unfixable: days(90)},
+		{Severity: "MEDIUM", Unfixable: days(30)},
+	}
+	tests := []struct {
+		name          string
+		vuln          metadata.Vulnerability
+		wantViolation bool
+		wantDeadline  time.Time
+	}{
+		{
+			name: "fixable within window",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH", HasFixAvailable: true,
+				CreateTime: now.Add(-100 * 24 * time.Hour), UpdateTime: now.Add(-13 * 24 * time.Hour)},
+		},
+		{
+			name: "fixable past window",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH", HasFixAvailable: true,
+				CreateTime: now.Add(-100 * 24 * time.Hour), UpdateTime: now.Add(-15 * 24 * time.Hour)},
+			wantViolation: true,
+			wantDeadline:  now.Add(-24 * time.Hour),
+		},
+		{
+			name: "fix released long after first seen",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH", HasFixAvailable: true,
+				CreateTime: now.Add(-300 * 24 * time.Hour), UpdateTime: now.Add(-24 * time.Hour)},
+		},
+		{
+			name: "update time before first seen",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH", HasFixAvailable: true,
+				CreateTime: now.Add(-15 * 24 * time.Hour), UpdateTime: now.Add(-30 * 24 * time.Hour)},
+			wantViolation: true,
+			wantDeadline:  now.Add(-24 * time.Hour),
+		},
+		{
+			name: "unfixable within window",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH",
+				CreateTime: now.Add(-89 * 24 * time.Hour), UpdateTime: now},
+		},
+		{
+			name: "unfixable past window",
+			vuln: metadata.Vulnerability{CVE: "c", Severity: "HIGH",
+				CreateTime: now.Add(-91 * 24 * time.Hour), UpdateTime: now},
+			wantViolation: true,
+			wantDeadline:  now.Add(-24 * time.Hour),
+		},
+		{
+			name:          "no window for fixable",
+			vuln:          metadata.Vulnerability{CVE: "c", Severity: "MEDIUM", HasFixAvailable: true, CreateTime: now, UpdateTime: now},
+			wantViolation: true,
+		},
+		{
+			name:          "no window for severity",
+			vuln:          metadata.Vulnerability{CVE: "c", Severity: "CRITICAL", CreateTime: now, UpdateTime: now},
+			wantViolation: true,
+		},
+		{
+			name:          "unknown times",
+			vuln:          metadata.Vulnerability{CVE: "c", Severity: "HIGH"},
+			wantViolation: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isp := v1beta1.ImageSecurityPolicy{
+				Spec: v1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity:    "LOW",
+						RemediationWindows: windows,
+					},
+				},
+			}
+			mc := testutil.MockMetadataClient{
+				Vulnz: []metadata.Vulnerability{test.vuln},
+			}
+			violations, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, mc)
+			if err != nil {
+				t.Fatalf("error validating isp: %v", err)
+			}
+			if (len(violations) != 0) != test.wantViolation {
+				t.Fatalf("got violations %v, expected violations: %v", violations, test.wantViolation)
+			}
+			if !test.wantViolation {
+				return
+			}
+			expected := withRemediationDeadline(ExceedsMaxSeverityViolationReason(testutil.QualifiedImage, test.vuln, isp), test.wantDeadline)
+			if violations[0].Reason != expected {
+				t.Errorf("got reason %q, expected %q", violations[0].Reason, expected)
+			}
+		})
+	}
+}
+
+func Test_withRemediationDeadline(t *testing.T) {
+	deadline := time.Date(2019, 1, 31, 12, 0, 0, 0, time.UTC)
+	expected := Violation("found CVE c, and its remediation window ran out at 2019-01-31T12:00:00Z")
+	if actual := withRemediationDeadline("found CVE c", deadline); actual != expected {
+		t.Errorf("got %q, expected %q", actual, expected)
+	}
+	if actual := withRemediationDeadline("found CVE c", time.Time{}); actual != "found CVE c" {
+		t.Errorf("got %q, expected the reason unchanged", actual)
+	}
+}
@@ -18,39 +18,20 @@ package securitypolicy
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
-	clientset "github.com/grafeas/kritis/pkg/kritis/client/clientset/versioned"
 	"github.com/grafeas/kritis/pkg/kritis/constants"
 	"github.com/grafeas/kritis/pkg/kritis/kubectl/plugins/resolve"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/util"
 	ca "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/rest"
 )
 
 // ValidateFunc defines the type for Validating Image Security Policies
 type ValidateFunc func(isp v1beta1.ImageSecurityPolicy, image string, client metadata.MetadataFetcher) ([]SecurityPolicyViolation, error)
 
-// ImageSecurityPolicies returns all ISP's in the specified namespaces
-// Pass in an empty string to get all ISPs in all namespaces
-func ImageSecurityPolicies(namespace string) ([]v1beta1.ImageSecurityPolicy, error) {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, fmt.Errorf("error building config: %v", err)
-	}
-
-	client, err := clientset.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("error building clientset: %v", err)
-	}
-	list, err := client.KritisV1beta1().ImageSecurityPolicies(namespace).List(metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error listing all image policy requirements: %v", err)
-	}
-	return list.Items, nil
-}
-
 // ValidateImageSecurityPolicy checks if an image satisfies ISP requirements
 // It returns a list of vulnerabilities that don't pass
 func ValidateImageSecurityPolicy(isp v1beta1.ImageSecurityPolicy, image string, client metadata.MetadataFetcher) ([]SecurityPolicyViolation, error) {
@@ -68,55 +49,154 @@ func ValidateImageSecurityPolicy(isp v1beta1.ImageSecurityPolicy, image string,
 		return violations, nil
 	}
 	// Now, check vulnz in the image
+	// Only a BackendError may fail open, an image the backend can't analyze is an error
 	vulnz, err := client.GetVulnerabilities(image)
 	if err != nil {
 		return nil, err
 	}
 
+	reqs := isp.Spec.PackageVulnerabilityRequirements
+	now := time.Now()
+	var counted []metadata.Vulnerability
 	for _, v := range vulnz {
 		// First, check if the vulnerability is whitelisted
-		if cveInWhitelist(isp, v.CVE) {
+		if cveInWhitelist(isp, v.CVE) || packageExcepted(isp, v) {
 			continue
 		}
-		// Check ifFixesNotAvailable
-		if isp.Spec.PackageVulnerabilityRequirements.OnlyFixesNotAvailable && !v.HasFixAvailable {
-			violations = append(violations, SecurityPolicyViolation{
-				Vulnerability: v,
-				Violation:     FixesNotAvailableViolation,
-				Reason:        FixesNotAvailableViolationReason(image, v),
-			})
+		// Then, if it's still within its remediation window
+		deadline := remediationDeadline(reqs.RemediationWindows, v)
+		if now.Before(deadline) {
 			continue
 		}
-		// Next, see if the severity is below or at threshold
-		err, ok := severityWithinThreshold(isp.Spec.PackageVulnerabilityRequirements.MaximumSeverity, v.Severity)
+		counted = append(counted, v)
+		vvs, err := vulnerabilityViolations(isp, image, v)
 		if err != nil {
-			return violations, fmt.Errorf("severityWithinThreshold: %v", err)
+			return violations, err
 		}
-		if ok {
-			continue
+		for _, vv := range vvs {
+			vv.Reason = withRemediationDeadline(vv.Reason, deadline)
+			violations = append(violations, vv)
 		}
-		// Else, add to list of CVEs in violation
-		violations = append(violations, SecurityPolicyViolation{
+	}
+	// Finally, count the vulnerabilities which aren't whitelisted against the budgets
+	exceeded, err := exceededBudgets(image, reqs.SeverityBudgets, counted)
+	if err != nil {
+		return violations, err
+	}
+	return append(violations, exceeded...), nil
+}
+
+// vulnerabilityViolations returns the violations of an ISP by a single vulnerability of an image
+func vulnerabilityViolations(isp v1beta1.ImageSecurityPolicy, image string, v metadata.Vulnerability) ([]SecurityPolicyViolation, error) {
+	reqs := isp.Spec.PackageVulnerabilityRequirements
+	// Check ifFixesNotAvailable
+	if reqs.OnlyFixesNotAvailable && !v.HasFixAvailable {
+		return []SecurityPolicyViolation{{
 			Vulnerability: v,
-			Violation:     ExceedsMaxSeverityViolation,
-			Reason:        ExceedsMaxSeverityViolationReason(image, v, isp),
-		})
+			Violation:     FixesNotAvailableViolation,
+			Reason:        FixesNotAvailableViolationReason(image, v),
+		}}, nil
+	}
+	// Next, see if the severity is below or at threshold
+	// The severity isn't checked if only a maximum CVSS score or budgets are set
+	if reqs.MaximumSeverity != "" || (reqs.MaximumCVSSScore == nil && len(reqs.SeverityBudgets) == 0) {
+		err, ok := severityWithinThreshold(reqs.MaximumSeverity, v.Severity)
+		if err != nil {
+			return nil, fmt.Errorf("severityWithinThreshold: %v", err)
+		}
+		if !ok {
+			return []SecurityPolicyViolation{{
+				Vulnerability: v,
+				Violation:     ExceedsMaxSeverityViolation,
+				Reason:        ExceedsMaxSeverityViolationReason(image, v, isp),
+			}}, nil
+		}
+	}
+	// Then, see if the CVSS score, if known, is below or at threshold
+	if reqs.MaximumCVSSScore != nil && v.CVSSScore > *reqs.MaximumCVSSScore {
+		return []SecurityPolicyViolation{{
+			Vulnerability: v,
+			Violation:     ExceedsMaxCVSSScoreViolation,
+			Reason:        ExceedsMaxCVSSScoreViolationReason(image, v, isp),
+		}}, nil
 	}
-	return violations, nil
+	return nil, nil
+}
+
+// EnforcementAction returns the enforcement action of an ISP
+// Policies with no action, or an unknown one, are enforced
+func EnforcementAction(isp v1beta1.ImageSecurityPolicy) v1beta1.EnforcementAction {
+	switch a := isp.Spec.EnforcementAction; a {
+	case v1beta1.EnforcementActionWarn, v1beta1.EnforcementActionAudit:
+		return a
+	case "", v1beta1.EnforcementActionEnforce:
+	default:
+		glog.Warningf("unknown enforcement action %q in image security policy %s/%s, enforcing it", a, isp.Namespace, isp.Name)
+	}
+	return v1beta1.EnforcementActionEnforce
+}
+
+// FailurePolicy returns the failure policy of an ISP
+// Policies with no failure policy, or an unknown one, use the cluster wide default
+func FailurePolicy(isp v1beta1.ImageSecurityPolicy, clusterDefault v1beta1.FailurePolicy) v1beta1.FailurePolicy {
+	switch p := isp.Spec.FailurePolicy; p {
+	case v1beta1.FailurePolicyOpen, v1beta1.FailurePolicyClosed:
+		return p
+	case "":
+	default:
+		glog.Warningf("unknown failure policy %q in image security policy %s/%s, using %s", p, isp.Namespace, isp.Name, clusterDefault)
+	}
+	return clusterDefault
 }
 
 func imageInWhitelist(isp v1beta1.ImageSecurityPolicy, image string) bool {
-	for _, i := range isp.Spec.ImageWhitelist {
-		if i == image {
+	for _, w := range isp.Spec.ImageWhitelist {
+		if util.MatchImage(w, image) {
 			return true
 		}
 	}
 	return false
 }
 
+// cveInWhitelist returns true if cve is whitelisted by an entry which hasn't expired
 func cveInWhitelist(isp v1beta1.ImageSecurityPolicy, cve string) bool {
+	now := time.Now()
 	for _, w := range isp.Spec.PackageVulnerabilityRequirements.WhitelistCVEs {
-		if w == cve {
+		if w.CVE == cve && !w.Expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageExcepted returns true if the package of a vulnerability has an exception for it which hasn't expired.
+// Vulnerabilities of unknown versions are only excepted by exceptions without a version range.
+func packageExcepted(isp v1beta1.ImageSecurityPolicy, v metadata.Vulnerability) bool {
+	if v.Package == "" {
+		return false
+	}
+	now := time.Now()
+	for _, e := range isp.Spec.PackageVulnerabilityRequirements.PackageExceptions {
+		if e.Package != v.Package || e.Expired(now) {
+			continue
+		}
+		if len(e.CVEs) != 0 && !contains(e.CVEs, v.CVE) {
+			continue
+		}
+		if e.VersionAtLeast != "" && (v.Version == "" || compareVersions(v.Version, e.VersionAtLeast) < 0) {
+			continue
+		}
+		if e.VersionBelow != "" && (v.Version == "" || compareVersions(v.Version, e.VersionBelow) >= 0) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for _, i := range l {
+		if i == s {
 			return true
 		}
 	}
@@ -17,11 +17,14 @@ limitations under the License.
 package securitypolicy
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
 	"github.com/grafeas/kritis/pkg/kritis/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func Test_ValidISP(t *testing.T) {
@@ -88,7 +91,7 @@ func Test_BlockallPass(t *testing.T) {
 		Spec: v1beta1.ImageSecurityPolicySpec{
 			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
 				MaximumSeverity: "BLOCKALL",
-				WhitelistCVEs:   []string{"l", "m", "c"},
+				WhitelistCVEs:   []v1beta1.WhitelistCVE{{CVE: "l"}, {CVE: "m"}, {CVE: "c"}},
 			},
 		},
 	}
@@ -113,7 +116,7 @@ func Test_BlockallFail(t *testing.T) {
 		Spec: v1beta1.ImageSecurityPolicySpec{
 			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
 				MaximumSeverity: "BLOCKALL",
-				WhitelistCVEs:   []string{"m"},
+				WhitelistCVEs:   []v1beta1.WhitelistCVE{{CVE: "m"}},
 			},
 		},
 	}
@@ -178,13 +181,45 @@ func Test_WhitelistedImage(t *testing.T) {
 	}
 }
 
+func Test_WhitelistedImagePattern(t *testing.T) {
+	isp := v1beta1.ImageSecurityPolicy{
+		Spec: v1beta1.ImageSecurityPolicySpec{
+			ImageWhitelist: []string{"gcr.io/proj/**@sha256:*"},
+			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+				MaximumSeverity: "LOW",
+			},
+		},
+	}
+	mc := testutil.MockMetadataClient{
+		Vulnz: []metadata.Vulnerability{{CVE: "m", Severity: "MEDIUM"}},
+	}
+	tests := []struct {
+		image          string
+		wantViolations bool
+	}{
+		{"gcr.io/proj/team/app@sha256:foo", false},
+		{"gcr.io/other/app@sha256:foo", true},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			violations, err := ValidateImageSecurityPolicy(isp, test.image, mc)
+			if err != nil {
+				t.Errorf("error validating isp: %v", err)
+			}
+			if (len(violations) != 0) != test.wantViolations {
+				t.Errorf("got violations %v, expected violations: %v", violations, test.wantViolations)
+			}
+		})
+	}
+}
+
 func Test_WhitelistedCVEAboveSeverityThreshold(t *testing.T) {
 	isp := v1beta1.ImageSecurityPolicy{
 		Spec: v1beta1.ImageSecurityPolicySpec{
 			ImageWhitelist: []string{"image"},
 			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
 				MaximumSeverity: "LOW",
-				WhitelistCVEs:   []string{"c"},
+				WhitelistCVEs:   []v1beta1.WhitelistCVE{{CVE: "c"}},
 			},
 		},
 	}
@@ -240,7 +275,7 @@ func Test_OnlyFixesNotAvailablePassWithWhitelist(t *testing.T) {
 			PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
 				MaximumSeverity:       "CRITICAL",
 				OnlyFixesNotAvailable: true,
-				WhitelistCVEs:         []string{"c"},
+				WhitelistCVEs:         []v1beta1.WhitelistCVE{{CVE: "c"}},
 			},
 		},
 	}
@@ -256,6 +291,144 @@ func Test_OnlyFixesNotAvailablePassWithWhitelist(t *testing.T) {
 	}
 }
 
+func Test_WhitelistCVEExpiry(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	future := metav1.NewTime(time.Now().Add(time.Hour))
+	tests := []struct {
+		name           string
+		entry          v1beta1.WhitelistCVE
+		wantViolations bool
+	}{
+		{"no expiry", v1beta1.WhitelistCVE{CVE: "c"}, false},
+		{"not expired", v1beta1.WhitelistCVE{CVE: "c", Owner: "team", Justification: "not reachable", Expiry: &future}, false},
+		{"expired", v1beta1.WhitelistCVE{CVE: "c", Owner: "team", Justification: "not reachable", Expiry: &past}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isp := v1beta1.ImageSecurityPolicy{
+				Spec: v1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity: "LOW",
+						WhitelistCVEs:   []v1beta1.WhitelistCVE{test.entry},
+					},
+				},
+			}
+			mc := testutil.MockMetadataClient{
+				Vulnz: []metadata.Vulnerability{{CVE: "c", Severity: "CRITICAL"}},
+			}
+			violations, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, mc)
+			if err != nil {
+				t.Errorf("error validating isp: %v", err)
+			}
+			if (len(violations) != 0) != test.wantViolations {
+				t.Errorf("got violations %v, expected violations: %v", violations, test.wantViolations)
+			}
+		})
+	}
+}
+
+func Test_PackageExceptions(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	openssl := metadata.Vulnerability{CVE: "c", Severity: "CRITICAL", Package: "openssl", Version: "1.1.1j"}
+	tests := []struct {
+		name           string
+		exception      v1beta1.PackageException
+		vuln           metadata.Vulnerability
+		wantViolations bool
+	}{
+		{"whole package", v1beta1.PackageException{Package: "openssl"}, openssl, false},
+		{"other package", v1beta1.PackageException{Package: "foo"}, openssl, true},
+		{"cve in package", v1beta1.PackageException{Package: "openssl", CVEs: []string{"c"}}, openssl, false},
+		{"other cve in package", v1beta1.PackageException{Package: "openssl", CVEs: []string{"d"}}, openssl, true},
+		{"below version", v1beta1.PackageException{Package: "openssl", VersionBelow: "1.1.1k"}, openssl, false},
+		{"not below version", v1beta1.PackageException{Package: "openssl", VersionBelow: "1.1.1j"}, openssl, true},
+		{"at least version", v1beta1.PackageException{Package: "openssl", VersionAtLeast: "1.1.1j"}, openssl, false},
+		{"not at least version", v1beta1.PackageException{Package: "openssl", VersionAtLeast: "1.1.1k"}, openssl, true},
+		{"in range", v1beta1.PackageException{Package: "openssl", VersionAtLeast: "1.1.0", VersionBelow: "1.1.1k"}, openssl, false},
+		{"unknown version in range", v1beta1.PackageException{Package: "openssl", VersionBelow: "1.1.1k"},
+			metadata.Vulnerability{CVE: "c", Severity: "CRITICAL", Package: "openssl"}, true},
+		{"unknown package", v1beta1.PackageException{Package: ""},
+			metadata.Vulnerability{CVE: "c", Severity: "CRITICAL"}, true},
+		{"expired", v1beta1.PackageException{Package: "openssl", Expiry: &past}, openssl, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isp := v1beta1.ImageSecurityPolicy{
+				Spec: v1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity:   "LOW",
+						PackageExceptions: []v1beta1.PackageException{test.exception},
+					},
+				},
+			}
+			mc := testutil.MockMetadataClient{
+				Vulnz: []metadata.Vulnerability{test.vuln},
+			}
+			violations, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, mc)
+			if err != nil {
+				t.Errorf("error validating isp: %v", err)
+			}
+			if (len(violations) != 0) != test.wantViolations {
+				t.Errorf("got violations %v, expected violations: %v", violations, test.wantViolations)
+			}
+		})
+	}
+}
+
+func Test_MaximumCVSSScore(t *testing.T) {
+	score := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name          string
+		maxSeverity   string
+		maxScore      *float64
+		vuln          metadata.Vulnerability
+		wantViolation int
+	}{
+		{"score below max", "", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 5}, -1},
+		{"score at max", "", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 6.9}, -1},
+		{"score above max", "", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "LOW", CVSSScore: 7}, ExceedsMaxCVSSScoreViolation},
+		{"unknown score", "", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "CRITICAL"}, -1},
+		{"severity checked first", "LOW", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 7}, ExceedsMaxSeverityViolation},
+		{"severity within max", "HIGH", score(6.9), metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 7}, ExceedsMaxCVSSScoreViolation},
+		{"no max score", "HIGH", nil, metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 10}, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isp := v1beta1.ImageSecurityPolicy{
+				Spec: v1beta1.ImageSecurityPolicySpec{
+					PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+						MaximumSeverity:  test.maxSeverity,
+						MaximumCVSSScore: test.maxScore,
+					},
+				},
+			}
+			mc := testutil.MockMetadataClient{
+				Vulnz: []metadata.Vulnerability{test.vuln},
+			}
+			violations, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, mc)
+			if err != nil {
+				t.Fatalf("error validating isp: %v", err)
+			}
+			if test.wantViolation == -1 {
+				if len(violations) != 0 {
+					t.Fatalf("got unexpected violations: %v", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || violations[0].Violation != test.wantViolation {
+				t.Fatalf("got violations %v, expected a single %s violation", violations, ViolationType(test.wantViolation))
+			}
+		})
+	}
+	isp := v1beta1.ImageSecurityPolicy{}
+	isp.Spec.PackageVulnerabilityRequirements.MaximumCVSSScore = score(6.9)
+	v := metadata.Vulnerability{CVE: "c", Severity: "HIGH", CVSSScore: 7.5}
+	expected := "found CVE c in image, which has CVSS score 7.5 exceeding max CVSS score 6.9"
+	if reason := string(ExceedsMaxCVSSScoreViolationReason("image", v, isp)); reason != expected {
+		t.Errorf("got reason %q, expected %q", reason, expected)
+	}
+}
+
 func Test_severityWithinThreshold(t *testing.T) {
 	var tests = []struct {
 		name        string
@@ -301,3 +474,35 @@ func Test_severityWithinThreshold(t *testing.T) {
 		})
 	}
 }
+
+type errFetcher struct {
+	testutil.MockMetadataClient
+	err error
+}
+
+func (f errFetcher) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
+	return nil, f.err
+}
+
+func Test_MetadataErrors(t *testing.T) {
+	isp := v1beta1.ImageSecurityPolicy{}
+	tests := []struct {
+		name    string
+		err     error
+		backend bool
+	}{
+		{"backend error", &metadata.BackendError{Err: errors.New("unavailable")}, true},
+		{"invalid image", errors.New("gcr.io/foo is not a valid image hosted in GCR"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ValidateImageSecurityPolicy(isp, testutil.QualifiedImage, errFetcher{err: test.err})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if _, ok := err.(*metadata.BackendError); ok != test.backend {
+				t.Errorf("expected backend error %v, got %v", test.backend, err)
+			}
+		})
+	}
+}
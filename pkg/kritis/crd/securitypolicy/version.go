@@ -0,0 +1,123 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersions compares package versions of the form [epoch:]upstream[-revision]
+// as dpkg does, returning -1, 0 or 1 if a is lower than, equal to or higher than b.
+// A ~ sorts before anything, so that 1.0~rc1 is lower than 1.0.
+func compareVersions(a, b string) int {
+	ea, ua, ra := splitVersion(a)
+	eb, ub, rb := splitVersion(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(ua, ub); c != 0 {
+		return c
+	}
+	return compareVersionPart(ra, rb)
+}
+
+// splitVersion splits a version into its epoch, upstream version and revision
+func splitVersion(v string) (int, string, string) {
+	epoch := 0
+	if i := strings.Index(v, ":"); i != -1 {
+		if e, err := strconv.Atoi(v[:i]); err == nil {
+			epoch, v = e, v[i+1:]
+		}
+	}
+	revision := ""
+	if i := strings.LastIndex(v, "-"); i != -1 {
+		v, revision = v[:i], v[i+1:]
+	}
+	return epoch, v, revision
+}
+
+// compareVersionPart compares alternating runs of non digits, lexically, and digits, numerically
+func compareVersionPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			if oa, ob := versionOrder(a, i), versionOrder(b, j); oa != ob {
+				return sign(oa - ob)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// versionOrder returns the sort weight of the character at i of a non digit run
+func versionOrder(s string, i int) int {
+	if i >= len(s) || isDigit(s[i]) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case c == '~':
+		return -1
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicy
+
+import (
+	"testing"
+)
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.00", 0},
+		{"1.9", "1.10", -1},
+		{"1.1.1", "1.1.1k", -1},
+		{"1.1.1j", "1.1.1k", -1},
+		{"1.1.0l", "1.1.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0", "1.0+deb9u1", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1:0.9", "2.0", 1},
+		{"0:2.0", "2.0", 0},
+		{"2.24-11+deb9u3", "2.24-11+deb9u4", -1},
+	}
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			if actual := compareVersions(test.a, test.b); actual != test.expected {
+				t.Errorf("compareVersions(%q, %q) = %d, expected %d", test.a, test.b, actual, test.expected)
+			}
+			if actual := compareVersions(test.b, test.a); actual != -test.expected {
+				t.Errorf("compareVersions(%q, %q) = %d, expected %d", test.b, test.a, actual, -test.expected)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ package securitypolicy
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/constants"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
@@ -31,8 +33,28 @@ const (
 	UnqualifiedImageViolation int = iota
 	FixesNotAvailableViolation
 	ExceedsMaxSeverityViolation
+	ExceedsMaxCVSSScoreViolation
+	ExceedsSeverityBudgetViolation
 )
 
+// violationTypes are the names of the security policy violations,
+// used to identify them in admission responses
+var violationTypes = map[int]string{
+	UnqualifiedImageViolation:      "UnqualifiedImage",
+	FixesNotAvailableViolation:     "FixesNotAvailable",
+	ExceedsMaxSeverityViolation:    "ExceedsMaxSeverity",
+	ExceedsMaxCVSSScoreViolation:   "ExceedsMaxCvssScore",
+	ExceedsSeverityBudgetViolation: "ExceedsSeverityBudget",
+}
+
+// ViolationType returns the name of a security policy violation
+func ViolationType(violation int) string {
+	if t, ok := violationTypes[violation]; ok {
+		return t
+	}
+	return fmt.Sprintf("Violation%d", violation)
+}
+
 // SecurityPolicyViolation represents a vulnerability that violates an ISP
 type SecurityPolicyViolation struct {
 	Vulnerability metadata.Vulnerability
@@ -47,7 +69,7 @@ func UnqualifiedImageViolationReason(image string) Violation {
 
 // FixesAvailableViolationReason returns a detailed reason if a CVE doesn't have a fix available
 func FixesNotAvailableViolationReason(image string, vulnz metadata.Vulnerability) Violation {
-	return Violation(fmt.Sprintf("found CVE %s in %s which has fixes available", vulnz.CVE, image))
+	return Violation(fmt.Sprintf("found CVE %s in %s which has fixes available", vulnz.CVE, location(image, vulnz)))
 }
 
 // ExceedsMaxSeverityViolationReason returns a detailed reason if a CVE exceeds max severity
@@ -55,8 +77,53 @@ func ExceedsMaxSeverityViolationReason(image string, vulnz metadata.Vulnerabilit
 	maxSeverity := isp.Spec.PackageVulnerabilityRequirements.MaximumSeverity
 	if maxSeverity == constants.BLOCKALL {
 		return Violation(fmt.Sprintf("found CVE %s in %s which isn't whitelisted, violating max severity %s",
-			vulnz.CVE, image, maxSeverity))
+			vulnz.CVE, location(image, vulnz), maxSeverity))
+	}
+	return Violation(fmt.Sprintf("found CVE %s in %s, which has severity %s exceeding max severity %s", vulnz.CVE, location(image, vulnz),
+		severity(vulnz), maxSeverity))
+}
+
+// ExceedsMaxCVSSScoreViolationReason returns a detailed reason if a CVE exceeds the max CVSS score
+func ExceedsMaxCVSSScoreViolationReason(image string, vulnz metadata.Vulnerability, isp v1beta1.ImageSecurityPolicy) Violation {
+	return Violation(fmt.Sprintf("found CVE %s in %s, which has CVSS score %.1f exceeding max CVSS score %.1f", vulnz.CVE, location(image, vulnz),
+		vulnz.CVSSScore, *isp.Spec.PackageVulnerabilityRequirements.MaximumCVSSScore))
+}
+
+// ExceedsSeverityBudgetViolationReason returns a detailed reason if an image has more CVEs of a severity than its budget allows
+func ExceedsSeverityBudgetViolationReason(image string, budget v1beta1.SeverityBudget, count BudgetCount) Violation {
+	var limits []string
+	for _, l := range []struct {
+		name  string
+		limit *int
+		count int
+	}{
+		{"max", budget.Max, count.Fixable + count.Unfixable},
+		{"maxFixable", budget.MaxFixable, count.Fixable},
+		{"maxUnfixable", budget.MaxUnfixable, count.Unfixable},
+	} {
+		if l.limit != nil {
+			limits = append(limits, fmt.Sprintf("%d against %s %d", l.count, l.name, *l.limit))
+		}
+	}
+	return Violation(fmt.Sprintf("found %d %s CVEs in %s, %d fixable and %d unfixable, exceeding the %s budget: %s",
+		count.Fixable+count.Unfixable, budget.Severity, image, count.Fixable, count.Unfixable, budget.Severity, strings.Join(limits, ", ")))
+}
+
+// severity returns the severity of a vulnerability, with its CVSS score if known
+func severity(vulnz metadata.Vulnerability) string {
+	if vulnz.CVSSScore == 0 {
+		return vulnz.Severity
+	}
+	return fmt.Sprintf("%s (CVSS score %.1f)", vulnz.Severity, vulnz.CVSSScore)
+}
+
+// location returns where a vulnerability is found: the image, and the package if known
+func location(image string, vulnz metadata.Vulnerability) string {
+	if vulnz.Package == "" {
+		return image
+	}
+	if vulnz.Version == "" {
+		return fmt.Sprintf("package %s of %s", vulnz.Package, image)
 	}
-	return Violation(fmt.Sprintf("found CVE %s in %s, which has severity %s exceeding max severity %s", vulnz.CVE, image,
-		vulnz.Severity, maxSeverity))
+	return fmt.Sprintf("package %s %s of %s", vulnz.Package, vulnz.Version, image)
 }
@@ -18,17 +18,22 @@ package cron
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/breakglass"
+	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
 	"github.com/grafeas/kritis/pkg/kritis/pods"
 	"github.com/grafeas/kritis/pkg/kritis/review"
 
 	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
 	"github.com/grafeas/kritis/pkg/kritis/violation"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -38,7 +43,7 @@ var (
 )
 
 // For testing.
-type podLister func(string) ([]corev1.Pod, error)
+type podLister func(string) ([]pods.Pod, error)
 
 type Config struct {
 	PodLister            podLister
@@ -46,20 +51,31 @@ type Config struct {
 	ViolationStrategy    violation.Strategy
 	ViolationChecker     securitypolicy.ValidateFunc
 	SecurityPolicyLister func(namespace string) ([]v1beta1.ImageSecurityPolicy, error)
+	RecordEvent          func(ref corev1.ObjectReference, eventType, reason, message string) error
+	// WhitelistExpiryWarning is how long before a whitelisted CVE expires it's warned about
+	WhitelistExpiryWarning time.Duration
 }
 
+// DefaultWhitelistExpiryWarning is how long before a whitelisted CVE expires it's warned about by default
+const DefaultWhitelistExpiryWarning = 7 * 24 * time.Hour
+
 var (
-	defaultViolationStrategy = &violation.AnnotationStrategy{}
+	defaultViolationStrategy = violation.Strategies{
+		&violation.AnnotationStrategy{},
+		&violation.EventStrategy{RecordEvent: kubernetesutil.RecordEvent},
+	}
 )
 
 func NewCronConfig(cs *kubernetes.Clientset, client metadata.MetadataFetcher) *Config {
 
 	cfg := Config{
-		PodLister:            pods.Pods,
-		Client:               client,
-		ViolationStrategy:    defaultViolationStrategy,
-		ViolationChecker:     securitypolicy.ValidateImageSecurityPolicy,
-		SecurityPolicyLister: securitypolicy.ImageSecurityPolicies,
+		PodLister:              pods.Pods,
+		Client:                 client,
+		ViolationStrategy:      defaultViolationStrategy,
+		ViolationChecker:       securitypolicy.ValidateImageSecurityPolicy,
+		SecurityPolicyLister:   securitypolicy.EffectivePolicies,
+		RecordEvent:            kubernetesutil.RecordEvent,
+		WhitelistExpiryWarning: DefaultWhitelistExpiryWarning,
 	}
 	return &cfg
 }
@@ -78,6 +94,7 @@ func Start(ctx context.Context, cfg Config, checkInterval time.Duration) {
 				glog.Errorf("fetching image security policies: %s", err)
 				continue
 			}
+			CheckWhitelists(cfg, isps, time.Now())
 			if err := podChecker(cfg, isps); err != nil {
 				glog.Errorf("error checking pods: %s", err)
 			}
@@ -87,20 +104,136 @@ func Start(ctx context.Context, cfg Config, checkInterval time.Duration) {
 	}
 }
 
-// CheckPods checks all running pods against defined policies.
+// CheckPods checks all running pods against the policies of their namespace.
+// Pods with a breakglass are skipped until it expires.
 func CheckPods(cfg Config, isps []v1beta1.ImageSecurityPolicy) error {
+	start := time.Now()
+	flagged := 0
+	defer func() {
+		metrics.RecordCronCycle(time.Since(start), flagged)
+	}()
 	r := review.New(cfg.Client, cfg.ViolationStrategy, cfg.ViolationChecker)
+	var namespaces []string
+	byNamespace := map[string][]v1beta1.ImageSecurityPolicy{}
 	for _, isp := range isps {
-		ps, err := cfg.PodLister(isp.Namespace)
+		if _, ok := byNamespace[isp.Namespace]; !ok {
+			namespaces = append(namespaces, isp.Namespace)
+		}
+		byNamespace[isp.Namespace] = append(byNamespace[isp.Namespace], isp)
+	}
+	for _, ns := range namespaces {
+		ps, err := cfg.PodLister(ns)
 		if err != nil {
 			return err
 		}
 		for _, p := range ps {
+			if skipBreakglass(cfg, p.Pod) {
+				continue
+			}
 			glog.Infof("Checking po %s", p.Name)
-			if err := r.Review(pods.Images(p), isps, &p); err != nil {
-				glog.Error(err)
+			err := r.Review(p.Images(), byNamespace[ns], &p.Pod)
+			if err == nil {
+				continue
+			}
+			glog.Error(err)
+			if verr, ok := err.(*review.ViolationError); ok && flaggedViolations(verr) {
+				flagged++
 			}
 		}
 	}
 	return nil
 }
+
+// CheckWhitelists warns about whitelisted CVEs and package exceptions which
+// expire within the expiry warning of now, or have expired and no longer suppress
+// violations. The warnings are logged and recorded as events on the image security policy.
+// A cluster image security policy is only checked once, rather than for every namespace it selects.
+func CheckWhitelists(cfg Config, isps []v1beta1.ImageSecurityPolicy, now time.Time) {
+	checked := map[string]bool{}
+	for _, isp := range isps {
+		if securitypolicy.IsClusterPolicy(isp) {
+			if checked[isp.Name] {
+				continue
+			}
+			checked[isp.Name] = true
+		}
+		reqs := isp.Spec.PackageVulnerabilityRequirements
+		for _, w := range reqs.WhitelistCVEs {
+			warnExpiry(cfg, isp, now, "WhitelistCVE", "whitelisted "+w.CVE, w.Expiry, w.Owner, w.Justification)
+		}
+		for _, e := range reqs.PackageExceptions {
+			warnExpiry(cfg, isp, now, "PackageException", "exception for package "+e.Package, e.Expiry, e.Owner, e.Justification)
+		}
+	}
+}
+
+// warnExpiry warns about an entry of isp if its expiry is within the expiry warning of now.
+// The reason of the event is kind followed by Expiring or Expired.
+func warnExpiry(cfg Config, isp v1beta1.ImageSecurityPolicy, now time.Time, kind, entry string, expiry *metav1.Time, owner, justification string) {
+	if expiry == nil || expiry.Time.Sub(now) > cfg.WhitelistExpiryWarning {
+		return
+	}
+	reason, verb := kind+"Expiring", "expires"
+	if !now.Before(expiry.Time) {
+		reason, verb = kind+"Expired", "expired"
+	}
+	msg := fmt.Sprintf("%s %s at %s (owner: %q, justification: %q)", entry, verb, expiry.UTC().Format(time.RFC3339), owner, justification)
+	ref := corev1.ObjectReference{
+		Kind:       "ImageSecurityPolicy",
+		APIVersion: v1beta1.SchemeGroupVersion.String(),
+		Namespace:  isp.Namespace,
+		Name:       isp.Name,
+		UID:        isp.UID,
+	}
+	if securitypolicy.IsClusterPolicy(isp) {
+		ref.Kind, ref.Namespace = securitypolicy.ClusterImageSecurityPolicyKind, ""
+	}
+	glog.Warningf("image security policy %s: %s", policyName(ref), msg)
+	if err := cfg.RecordEvent(ref, corev1.EventTypeWarning, reason, msg); err != nil {
+		glog.Errorf("error recording %s event for %s: %v", reason, policyName(ref), err)
+	}
+}
+
+// policyName returns the namespaced name of the policy referenced by ref
+func policyName(ref corev1.ObjectReference) string {
+	if ref.Namespace == "" {
+		return ref.Name
+	}
+	return ref.Namespace + "/" + ref.Name
+}
+
+// skipBreakglass returns true if the pod carries a breakglass which still applies.
+// An expired breakglass is recorded as an event, so that the pod is flagged again.
+func skipBreakglass(cfg Config, p corev1.Pod) bool {
+	bg, err := breakglass.Get(p.ObjectMeta)
+	if err != nil {
+		glog.Warningf("ignoring breakglass of pod %s/%s: %v", p.Namespace, p.Name, err)
+		return false
+	}
+	if bg == nil {
+		return false
+	}
+	if !bg.Expired(time.Now()) {
+		glog.Infof("Skipping po %s with breakglass: %s", p.Name, bg.Justification)
+		return true
+	}
+	msg := fmt.Sprintf("breakglass expired at %s: %s", bg.Expiry.Format(time.RFC3339), bg.Justification)
+	glog.Warningf("pod %s/%s %s", p.Namespace, p.Name, msg)
+	ref := corev1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  p.Namespace,
+		Name:       p.Name,
+		UID:        p.UID,
+	}
+	if err := cfg.RecordEvent(ref, corev1.EventTypeWarning, "BreakglassExpired", msg); err != nil {
+		glog.Errorf("error recording breakglass event for %s/%s: %v", p.Namespace, p.Name, err)
+	}
+	return false
+}
+
+// flaggedViolations returns true if violations were passed to the violation strategy,
+// i.e. if any of them isn't audited
+func flaggedViolations(verr *review.ViolationError) bool {
+	return len(verr.Violations) != len(verr.WithAction(v1beta1.EnforcementActionAudit))
+}
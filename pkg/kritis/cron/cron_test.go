@@ -18,12 +18,14 @@ package cron
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/pods"
 	"github.com/grafeas/kritis/pkg/kritis/violation"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -81,33 +83,70 @@ func (iv *imageViolations) violationChecker(isp v1beta1.ImageSecurityPolicy, ima
 }
 
 type testLister struct {
-	pl []v1.Pod
+	pl []pods.Pod
 }
 
-func (tl *testLister) list(ns string) ([]v1.Pod, error) {
+func (tl *testLister) list(ns string) ([]pods.Pod, error) {
 	return tl.pl, nil
 }
 
 var testPods = testLister{
-	pl: []v1.Pod{
+	pl: []pods.Pod{
 		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "foo",
-				Namespace: "bar",
+			Pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Image: "gcr.io/foo/bar@sha256:baz",
+						},
+					},
+				},
 			},
-			Spec: v1.PodSpec{
-				Containers: []v1.Container{
-					{
-						Image: "gcr.io/foo/bar@sha256:baz",
+		},
+	},
+}
+
+// ephemeralPods has the image of testPods in an ephemeral container only
+var ephemeralPods = testLister{
+	pl: []pods.Pod{
+		{
+			Pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Image: "gcr.io/foo/clean@sha256:baz",
+						},
 					},
 				},
 			},
+			EphemeralImages: []string{"gcr.io/foo/bar@sha256:baz"},
 		},
 	},
 }
 
 var noPods = testLister{}
 
+// breakglassPods returns testPods carrying a breakglass expiring at expiry
+func breakglassPods(expiry time.Time) testLister {
+	p := *testPods.pl[0].Pod.DeepCopy()
+	p.Annotations = map[string]string{
+		"kritis.grafeas.io/breakglass":        "hotfix",
+		"kritis.grafeas.io/breakglass-expiry": expiry.Format(time.RFC3339),
+	}
+	return testLister{pl: []pods.Pod{{Pod: p}}}
+}
+
+var activeBreakglassPods = breakglassPods(time.Now().Add(time.Hour))
+var expiredBreakglassPods = breakglassPods(time.Now().Add(-time.Hour))
+
 var noVulnz = imageViolations{}
 var someVulnz = imageViolations{
 	imageMap: map[string]bool{
@@ -123,6 +162,17 @@ var isps = []v1beta1.ImageSecurityPolicy{
 	},
 }
 
+var auditIsps = []v1beta1.ImageSecurityPolicy{
+	{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+		},
+		Spec: v1beta1.ImageSecurityPolicySpec{
+			EnforcementAction: v1beta1.EnforcementActionAudit,
+		},
+	},
+}
+
 func TestCheckPods(t *testing.T) {
 	type args struct {
 		cfg  Config
@@ -132,6 +182,7 @@ func TestCheckPods(t *testing.T) {
 		name           string
 		args           args
 		wantViolations bool
+		wantEvents     int
 	}{
 		{
 			name: "no vulnz",
@@ -155,6 +206,51 @@ func TestCheckPods(t *testing.T) {
 			},
 			wantViolations: true,
 		},
+		{
+			name: "vulnz in ephemeral container",
+			args: args{
+				cfg: Config{
+					ViolationChecker: someVulnz.violationChecker,
+					PodLister:        ephemeralPods.list,
+				},
+				isps: isps,
+			},
+			wantViolations: true,
+		},
+		{
+			name: "audit isps",
+			args: args{
+				cfg: Config{
+					ViolationChecker: someVulnz.violationChecker,
+					PodLister:        testPods.list,
+				},
+				isps: auditIsps,
+			},
+			wantViolations: false,
+		},
+		{
+			name: "active breakglass",
+			args: args{
+				cfg: Config{
+					ViolationChecker: someVulnz.violationChecker,
+					PodLister:        activeBreakglassPods.list,
+				},
+				isps: isps,
+			},
+			wantViolations: false,
+		},
+		{
+			name: "expired breakglass",
+			args: args{
+				cfg: Config{
+					ViolationChecker: someVulnz.violationChecker,
+					PodLister:        expiredBreakglassPods.list,
+				},
+				isps: isps,
+			},
+			wantViolations: true,
+			wantEvents:     1,
+		},
 		{
 			name: "no isps",
 			args: args{
@@ -183,6 +279,11 @@ func TestCheckPods(t *testing.T) {
 			Violations: map[string]bool{},
 		}
 		tt.args.cfg.ViolationStrategy = &th
+		events := 0
+		tt.args.cfg.RecordEvent = func(ref v1.ObjectReference, eventType, reason, message string) error {
+			events++
+			return nil
+		}
 		t.Run(tt.name, func(t *testing.T) {
 			if err := CheckPods(tt.args.cfg, tt.args.isps); err != nil {
 				t.Fatalf("CheckPods() error = %v", err)
@@ -191,5 +292,82 @@ func TestCheckPods(t *testing.T) {
 		if (len(th.Violations) != 0) != tt.wantViolations {
 			t.Fatalf("got violations %v, expected to have %v", th.Violations, tt.wantViolations)
 		}
+		if events != tt.wantEvents {
+			t.Fatalf("got %d events, expected %d", events, tt.wantEvents)
+		}
+	}
+}
+
+func TestCheckWhitelists(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+	isps := []v1beta1.ImageSecurityPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "isp"},
+			Spec: v1beta1.ImageSecurityPolicySpec{
+				PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+					WhitelistCVEs: []v1beta1.WhitelistCVE{
+						{CVE: "never"},
+						{CVE: "later", Expiry: at(30 * 24 * time.Hour)},
+						{CVE: "soon", Expiry: at(24 * time.Hour), Owner: "team"},
+						{CVE: "expired", Expiry: at(-time.Hour)},
+					},
+					PackageExceptions: []v1beta1.PackageException{
+						{Package: "never"},
+						{Package: "soon", Expiry: at(time.Hour)},
+					},
+				},
+			},
+		},
+	}
+	var reasons []string
+	cfg := Config{
+		WhitelistExpiryWarning: DefaultWhitelistExpiryWarning,
+		RecordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+			if ref.Kind != "ImageSecurityPolicy" || ref.Namespace != "foo" || ref.Name != "isp" {
+				t.Errorf("unexpected event reference %+v", ref)
+			}
+			reasons = append(reasons, reason)
+			return nil
+		},
+	}
+	CheckWhitelists(cfg, isps, now)
+	expected := []string{"WhitelistCVEExpiring", "WhitelistCVEExpired", "PackageExceptionExpiring"}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Fatalf("got events %v, expected %v", reasons, expected)
+	}
+}
+
+func TestCheckWhitelistsClusterPolicy(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiry := metav1.NewTime(now.Add(time.Hour))
+	cisp := func(namespace string) v1beta1.ImageSecurityPolicy {
+		return v1beta1.ImageSecurityPolicy{
+			TypeMeta:   metav1.TypeMeta{Kind: securitypolicy.ClusterImageSecurityPolicyKind},
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "baseline"},
+			Spec: v1beta1.ImageSecurityPolicySpec{
+				PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+					WhitelistCVEs: []v1beta1.WhitelistCVE{{CVE: "soon", Expiry: &expiry}},
+				},
+			},
+		}
+	}
+	var refs []v1.ObjectReference
+	cfg := Config{
+		WhitelistExpiryWarning: DefaultWhitelistExpiryWarning,
+		RecordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+			refs = append(refs, ref)
+			return nil
+		},
+	}
+	CheckWhitelists(cfg, []v1beta1.ImageSecurityPolicy{cisp("foo"), cisp("bar")}, now)
+	if len(refs) != 1 {
+		t.Fatalf("got %d events, expected 1", len(refs))
+	}
+	if refs[0].Kind != "ClusterImageSecurityPolicy" || refs[0].Namespace != "" || refs[0].Name != "baseline" {
+		t.Fatalf("unexpected event reference %+v", refs[0])
 	}
 }
@@ -0,0 +1,76 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves the liveness and readiness of kritis-server.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// Check is a named readiness check, which returns an error when not ready
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Checker serves /healthz and /readyz
+type Checker struct {
+	checks       []Check
+	shuttingDown int32
+}
+
+// NewChecker returns a Checker which is ready when all checks pass
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Healthz reports that the server is alive
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+// Readyz reports whether the server can review requests: it runs every check,
+// and fails once the server is shutting down
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shuttingDown) != 0 {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	var failed []string
+	for _, check := range c.checks {
+		if err := check.Check(); err != nil {
+			glog.Errorf("readiness check %s failed: %v", check.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", check.Name, err))
+		}
+	}
+	if len(failed) != 0 {
+		http.Error(w, strings.Join(failed, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+// ShutDown marks the server as not ready, so that it's taken out of the
+// endpoints of its service before it stops serving
+func (c *Checker) ShutDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
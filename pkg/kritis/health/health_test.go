@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	ok := Check{Name: "ok", Check: func() error { return nil }}
+	failing := Check{Name: "failing", Check: func() error { return fmt.Errorf("unavailable") }}
+	tests := []struct {
+		name         string
+		checks       []Check
+		shuttingDown bool
+		expected     int
+	}{
+		{"no checks", nil, false, http.StatusOK},
+		{"passing checks", []Check{ok, ok}, false, http.StatusOK},
+		{"failing check", []Check{ok, failing}, false, http.StatusServiceUnavailable},
+		{"shutting down", []Check{ok}, true, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewChecker(test.checks...)
+			if test.shuttingDown {
+				c.ShutDown()
+			}
+			rr := httptest.NewRecorder()
+			c.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+			if rr.Code != test.expected {
+				t.Errorf("got status %d, expected %d: %s", rr.Code, test.expected, rr.Body.String())
+			}
+			// Liveness doesn't depend on readiness
+			rr = httptest.NewRecorder()
+			c.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("got liveness status %d", rr.Code)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"gopkg.in/yaml.v2"
@@ -72,11 +73,21 @@ func executeSubstitution(contents string) (string, error) {
 
 // For testing
 var resolver = func(image string) (string, error) {
+	return ResolveTag(image, nil)
+}
+
+// ResolveTag resolves image:tag to image@sha256:digest
+// Credentials for the registry are looked up in keychain; pass nil to pull anonymously
+func ResolveTag(image string, keychain authn.Keychain) (string, error) {
 	tag, err := name.NewTag(image, name.WeakValidation)
 	if err != nil {
 		return "", err
 	}
-	sourceImage, err := remote.Image(tag)
+	var opts []remote.ImageOption
+	if keychain != nil {
+		opts = append(opts, remote.WithAuthFromKeychain(keychain))
+	}
+	sourceImage, err := remote.Image(tag, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// EventSource is the component kritis events are reported by
+const EventSource = "kritis"
+
+// RecordEvent records an event of eventType about the object referenced by ref.
+// Recording the same event again, e.g. on every cron cycle, bumps the count of
+// the existing event rather than creating a new one.
+func RecordEvent(ref v1.ObjectReference, eventType, reason, message string) error {
+	client, err := GetClientset()
+	if err != nil {
+		return err
+	}
+	// Events about cluster scoped objects are recorded in the default namespace
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return recordEvent(client.CoreV1().Events(namespace), namespace, ref, eventType, reason, message)
+}
+
+func recordEvent(events corev1.EventInterface, namespace string, ref v1.ObjectReference, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName(ref, eventType, reason, message),
+			Namespace: namespace,
+		},
+		InvolvedObject: ref,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: EventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := events.Create(event)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	// Another replica may be counting the same event
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := events.Get(event.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Count++
+		existing.LastTimestamp = now
+		_, err = events.Update(existing)
+		return err
+	})
+}
+
+// eventName is the name of the event, the same for identical events about the same object
+func eventName(ref v1.ObjectReference, eventType, reason, message string) string {
+	h := fnv.New64a()
+	for _, s := range []string{string(ref.UID), ref.Kind, ref.Name, eventType, reason, message} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s.%x", strings.TrimSuffix(ref.Name, "-"), h.Sum64())
+}
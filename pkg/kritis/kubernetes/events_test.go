@@ -0,0 +1,97 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeEvents stores events by name, other methods of EventInterface panic
+type fakeEvents struct {
+	corev1.EventInterface
+	events map[string]*v1.Event
+	// conflicts is how many updates fail with a conflict before one succeeds
+	conflicts int
+}
+
+func (f *fakeEvents) Create(e *v1.Event) (*v1.Event, error) {
+	if _, ok := f.events[e.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "events"}, e.Name)
+	}
+	f.events[e.Name] = e.DeepCopy()
+	return e, nil
+}
+
+func (f *fakeEvents) Get(name string, options metav1.GetOptions) (*v1.Event, error) {
+	return f.events[name].DeepCopy(), nil
+}
+
+func (f *fakeEvents) Update(e *v1.Event) (*v1.Event, error) {
+	if f.conflicts > 0 {
+		f.conflicts--
+		return nil, apierrors.NewConflict(schema.GroupResource{Resource: "events"}, e.Name, fmt.Errorf("modified"))
+	}
+	f.events[e.Name] = e.DeepCopy()
+	return e, nil
+}
+
+func Test_recordEvent(t *testing.T) {
+	events := &fakeEvents{events: map[string]*v1.Event{}}
+	pod := v1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: "pod", UID: "uid"}
+	record := func(ref v1.ObjectReference, message string) {
+		if err := recordEvent(events, "ns", ref, v1.EventTypeWarning, "SeverityViolation", message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(pod, "found CVE-1")
+	record(pod, "found CVE-1")
+	record(pod, "found CVE-1")
+	record(pod, "found CVE-2")
+	record(v1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: "pod", UID: "other"}, "found CVE-1")
+
+	if len(events.events) != 3 {
+		t.Fatalf("got %d events, expected 3", len(events.events))
+	}
+	e := events.events[eventName(pod, v1.EventTypeWarning, "SeverityViolation", "found CVE-1")]
+	if e == nil || e.Count != 3 {
+		t.Errorf("got event %v, expected a count of 3", e)
+	}
+}
+
+func Test_recordEventConflict(t *testing.T) {
+	events := &fakeEvents{events: map[string]*v1.Event{}, conflicts: 1}
+	pod := v1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: "pod", UID: "uid"}
+	for i := 0; i < 2; i++ {
+		if err := recordEvent(events, "ns", pod, v1.EventTypeWarning, "BreakglassExpired", "expired"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := events.events[eventName(pod, v1.EventTypeWarning, "BreakglassExpired", "expired")]
+	if e == nil || e.Count != 2 {
+		t.Errorf("got event %v, expected a count of 2", e)
+	}
+	if events.conflicts != 0 {
+		t.Errorf("the conflicting update wasn't retried")
+	}
+}
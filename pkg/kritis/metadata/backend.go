@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackendError is returned when the metadata backend fails or can't be reached,
+// as opposed to an image or a policy being invalid.
+type BackendError struct {
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("metadata backend error: %v", e.Err)
+}
+
+// WithDeadline returns a MetadataFetcher whose lookups fail with a BackendError
+// once deadline has passed, instead of waiting for the backend.
+func WithDeadline(f MetadataFetcher, deadline time.Time) MetadataFetcher {
+	return deadlineFetcher{MetadataFetcher: f, deadline: deadline}
+}
+
+type deadlineFetcher struct {
+	MetadataFetcher
+	deadline time.Time
+}
+
+func (f deadlineFetcher) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	type result struct {
+		vulnz []Vulnerability
+		err   error
+	}
+	c := make(chan result, 1)
+	go func() {
+		vulnz, err := f.MetadataFetcher.GetVulnerabilities(containerImage)
+		c <- result{vulnz, err}
+	}()
+	timer := time.NewTimer(time.Until(f.deadline))
+	defer timer.Stop()
+	select {
+	case r := <-c:
+		return r.vulnz, r.err
+	case <-timer.C:
+		return nil, &BackendError{Err: fmt.Errorf("deadline exceeded getting vulnerabilities for %s", containerImage)}
+	}
+}
+
+func (f deadlineFetcher) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	type result struct {
+		attestations []PGPAttestation
+		err          error
+	}
+	c := make(chan result, 1)
+	go func() {
+		attestations, err := f.MetadataFetcher.GetAttestations(containerImage)
+		c <- result{attestations, err}
+	}()
+	timer := time.NewTimer(time.Until(f.deadline))
+	defer timer.Stop()
+	select {
+	case r := <-c:
+		return r.attestations, r.err
+	case <-timer.C:
+		return nil, &BackendError{Err: fmt.Errorf("deadline exceeded getting attestations for %s", containerImage)}
+	}
+}
+
+// Unavailable returns a MetadataFetcher whose lookups all fail with err,
+// for when no client for the backend could be created.
+func Unavailable(err error) MetadataFetcher {
+	return unavailableFetcher{err: &BackendError{Err: err}}
+}
+
+type unavailableFetcher struct {
+	// Only lookups are implemented, the other methods panic
+	MetadataFetcher
+	err error
+}
+
+func (f unavailableFetcher) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	return nil, f.err
+}
+
+func (f unavailableFetcher) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	return nil, f.err
+}
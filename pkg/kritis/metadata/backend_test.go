@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// sleepFetcher answers lookups after delay
+type sleepFetcher struct {
+	MetadataFetcher
+	delay time.Duration
+}
+
+func (f sleepFetcher) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	time.Sleep(f.delay)
+	return []Vulnerability{{CVE: "CVE-1"}}, nil
+}
+
+func (f sleepFetcher) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	time.Sleep(f.delay)
+	return []PGPAttestation{{KeyId: "key"}}, nil
+}
+
+func TestWithDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     time.Duration
+		shouldErr bool
+	}{
+		{"before deadline", 0, false},
+		{"after deadline", time.Second, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := WithDeadline(sleepFetcher{delay: test.delay}, time.Now().Add(50*time.Millisecond))
+			vulnz, err := f.GetVulnerabilities("image")
+			checkBackendError(t, test.shouldErr, err)
+			if !test.shouldErr && len(vulnz) != 1 {
+				t.Errorf("got vulnerabilities %v", vulnz)
+			}
+			attestations, err := f.GetAttestations("image")
+			checkBackendError(t, test.shouldErr, err)
+			if !test.shouldErr && len(attestations) != 1 {
+				t.Errorf("got attestations %v", attestations)
+			}
+		})
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	f := Unavailable(fmt.Errorf("no credentials"))
+	_, err := f.GetVulnerabilities("image")
+	checkBackendError(t, true, err)
+	_, err = f.GetAttestations("image")
+	checkBackendError(t, true, err)
+}
+
+func checkBackendError(t *testing.T, shouldErr bool, err error) {
+	t.Helper()
+	if !shouldErr {
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		return
+	}
+	if _, ok := err.(*BackendError); !ok {
+		t.Errorf("got %v, expected a backend error", err)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// CacheOptions configure a cache of metadata lookups
+type CacheOptions struct {
+	// TTL is how long a lookup is served without calling the backend
+	TTL time.Duration
+	// StaleTTL is how long after TTL a lookup is still served, while it's
+	// revalidated in the background
+	StaleTTL time.Duration
+	// MaxEntries bounds the lookups cached, the least recently used are evicted first
+	MaxEntries int
+}
+
+// Cached returns a MetadataFetcher which caches the vulnerabilities and
+// attestations of images referenced by digest. Concurrent lookups of an image
+// are coalesced into a single call to f. It's safe for concurrent use, so that
+// a single cache can be shared by the admission webhook and the cron job.
+func Cached(f MetadataFetcher, o CacheOptions) MetadataFetcher {
+	return &cache{
+		MetadataFetcher: f,
+		opts:            o,
+		now:             time.Now,
+		entries:         map[cacheKey]*list.Element{},
+		lru:             list.New(),
+	}
+}
+
+type cache struct {
+	MetadataFetcher
+	opts CacheOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	// lru holds the *cacheEntry of entries, most recently used first
+	lru *list.List
+}
+
+type cacheKey struct {
+	method string
+	image  string
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value interface{}
+	// fetched is when value was looked up, it's zero until a lookup succeeds
+	fetched time.Time
+	// call is the lookup in flight, if any
+	call *cacheCall
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func (c *cache) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	v, err := c.get(cacheKey{"GetVulnerabilities", containerImage}, func() (interface{}, error) {
+		return c.MetadataFetcher.GetVulnerabilities(containerImage)
+	})
+	vulnz, _ := v.([]Vulnerability)
+	return vulnz, err
+}
+
+func (c *cache) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	v, err := c.get(cacheKey{"GetAttestations", containerImage}, func() (interface{}, error) {
+		return c.MetadataFetcher.GetAttestations(containerImage)
+	})
+	attestations, _ := v.([]PGPAttestation)
+	return attestations, err
+}
+
+// CreateAttestationOccurence creates the attestation and evicts the cached
+// attestations of the image, so that it's seen by the next lookup
+func (c *cache) CreateAttestationOccurence(note *containeranalysispb.Note,
+	containerImage string,
+	pgpSigningKey *secrets.PGPSigningSecret) (*containeranalysispb.Occurrence, error) {
+	occ, err := c.MetadataFetcher.CreateAttestationOccurence(note, containerImage, pgpSigningKey)
+	c.mu.Lock()
+	if el, ok := c.entries[cacheKey{"GetAttestations", containerImage}]; ok {
+		c.evict(el)
+	}
+	c.mu.Unlock()
+	return occ, err
+}
+
+// get returns the cached lookup of key if it's fresh. A stale lookup is returned
+// and revalidated in the background. Otherwise it waits for fetch, which is
+// called once for all concurrent lookups of key. Failed lookups aren't cached.
+func (c *cache) get(key cacheKey, fetch func() (interface{}, error)) (interface{}, error) {
+	// Tags can be moved to other images, only digests are cached
+	if !strings.Contains(key.image, "@sha256:") {
+		metrics.RecordCacheLookup(key.method, metrics.CacheUncacheable)
+		return fetch()
+	}
+	c.mu.Lock()
+	e := c.entry(key)
+	if !e.fetched.IsZero() {
+		age := c.now().Sub(e.fetched)
+		if age < c.opts.TTL {
+			v := e.value
+			c.mu.Unlock()
+			metrics.RecordCacheLookup(key.method, metrics.CacheHit)
+			return v, nil
+		}
+		if age < c.opts.TTL+c.opts.StaleTTL {
+			if e.call == nil {
+				c.start(e, fetch)
+			}
+			v := e.value
+			c.mu.Unlock()
+			metrics.RecordCacheLookup(key.method, metrics.CacheStale)
+			return v, nil
+		}
+	}
+	call := e.call
+	if call == nil {
+		call = c.start(e, fetch)
+	}
+	c.mu.Unlock()
+	metrics.RecordCacheLookup(key.method, metrics.CacheMiss)
+	<-call.done
+	return call.value, call.err
+}
+
+// entry returns the entry of key, creating it if needed, and marks it as the
+// most recently used. c.mu must be held.
+func (c *cache) entry(key cacheKey) *cacheEntry {
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*cacheEntry)
+	}
+	e := &cacheEntry{key: key}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		c.evict(c.lru.Back())
+	}
+	return e
+}
+
+// evict removes an entry from the cache. A lookup in flight for it still
+// completes for its callers, but isn't cached. c.mu must be held.
+func (c *cache) evict(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// start calls fetch in the background for e. c.mu must be held.
+func (c *cache) start(e *cacheEntry, fetch func() (interface{}, error)) *cacheCall {
+	call := &cacheCall{done: make(chan struct{})}
+	e.call = call
+	go func() {
+		call.value, call.err = fetch()
+		c.mu.Lock()
+		e.call = nil
+		if call.err == nil {
+			e.value, e.fetched = call.value, c.now()
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+const digest = "gcr.io/foo/bar@sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+// countingFetcher answers the n-th lookup with CVE-n, once release is closed if set
+type countingFetcher struct {
+	MetadataFetcher
+	release chan struct{}
+	err     error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *countingFetcher) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []Vulnerability{{CVE: fmt.Sprintf("CVE-%d", f.calls)}}, nil
+}
+
+func (f *countingFetcher) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return []PGPAttestation{{KeyId: fmt.Sprintf("key-%d", f.calls)}}, nil
+}
+
+func (f *countingFetcher) CreateAttestationOccurence(note *containeranalysispb.Note, containerImage string, pgpSigningKey *secrets.PGPSigningSecret) (*containeranalysispb.Occurrence, error) {
+	return nil, nil
+}
+
+func (f *countingFetcher) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// newTestCache returns a cache whose clock is advanced by the returned func
+func newTestCache(f MetadataFetcher, o CacheOptions) (*cache, func(time.Duration)) {
+	c := Cached(f, o).(*cache)
+	var mu sync.Mutex
+	now := time.Now()
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return c, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func checkCVE(t *testing.T, c MetadataFetcher, image, expected string) {
+	t.Helper()
+	vulnz, err := c.GetVulnerabilities(image)
+	if err != nil {
+		t.Fatalf("GetVulnerabilities() error = %v", err)
+	}
+	if len(vulnz) != 1 || vulnz[0].CVE != expected {
+		t.Errorf("got vulnerabilities %v, expected %s", vulnz, expected)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	f := &countingFetcher{}
+	c, advance := newTestCache(f, CacheOptions{TTL: time.Minute, StaleTTL: time.Hour})
+	checkCVE(t, c, digest, "CVE-1")
+	checkCVE(t, c, digest, "CVE-1")
+	if f.count() != 1 {
+		t.Errorf("got %d backend calls for a fresh lookup, expected 1", f.count())
+	}
+
+	// Stale lookups are served while they are revalidated
+	advance(2 * time.Minute)
+	checkCVE(t, c, digest, "CVE-1")
+	for i := 0; i < 100; i++ {
+		if vulnz, _ := c.GetVulnerabilities(digest); vulnz[0].CVE == "CVE-2" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	checkCVE(t, c, digest, "CVE-2")
+	if f.count() != 2 {
+		t.Errorf("got %d backend calls after revalidating, expected 2", f.count())
+	}
+
+	// Expired lookups wait for the backend
+	advance(2 * time.Hour)
+	checkCVE(t, c, digest, "CVE-3")
+}
+
+func TestCacheUncacheable(t *testing.T) {
+	f := &countingFetcher{}
+	c, _ := newTestCache(f, CacheOptions{TTL: time.Minute})
+	checkCVE(t, c, "gcr.io/foo/bar:latest", "CVE-1")
+	checkCVE(t, c, "gcr.io/foo/bar:latest", "CVE-2")
+
+	f.err = fmt.Errorf("unavailable")
+	if _, err := c.GetVulnerabilities(digest); err == nil {
+		t.Fatal("expected an error")
+	}
+	f.err = nil
+	checkCVE(t, c, digest, "CVE-4")
+}
+
+func TestCacheCoalesces(t *testing.T) {
+	f := &countingFetcher{release: make(chan struct{})}
+	c, _ := newTestCache(f, CacheOptions{TTL: time.Minute})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCVE(t, c, digest, "CVE-1")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	if f.count() != 1 {
+		t.Errorf("got %d backend calls for concurrent lookups, expected 1", f.count())
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	f := &countingFetcher{}
+	c, _ := newTestCache(f, CacheOptions{TTL: time.Minute, MaxEntries: 2})
+	other := digest[:len(digest)-1] + "1"
+	checkCVE(t, c, digest, "CVE-1")
+	checkCVE(t, c, other, "CVE-2")
+	if _, err := c.GetAttestations(digest); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("got %d entries, expected 2", len(c.entries))
+	}
+	// The vulnerabilities of digest were the least recently used
+	checkCVE(t, c, other, "CVE-2")
+	checkCVE(t, c, digest, "CVE-4")
+
+	attestations, _ := c.GetAttestations(other)
+	if _, err := c.CreateAttestationOccurence(nil, other, nil); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.GetAttestations(other); again[0].KeyId == attestations[0].KeyId {
+		t.Errorf("got cached attestations %v after creating one", again)
+	}
+}
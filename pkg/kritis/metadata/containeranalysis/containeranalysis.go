@@ -18,11 +18,15 @@ package containeranalysis
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 
 	gen "cloud.google.com/go/devtools/containeranalysis/apiv1alpha1"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/google/go-containerregistry/pkg/name"
 	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/constants"
@@ -32,12 +36,17 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
 	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
 // Container Analysis Library Specific Constants.
 const (
 	PkgVulnerability     = "PACKAGE_VULNERABILITY"
 	AttestationAuthority = "ATTESTATION_AUTHORITY"
+	// Backend is the name of this backend in metrics
+	Backend = "containeranalysis"
 )
 
 // The ContainerAnalysis struct implements MetadataFetcher Interface.
@@ -58,6 +67,21 @@ func NewContainerAnalysisClient() (*ContainerAnalysis, error) {
 	}, nil
 }
 
+// Close closes the connection to the Container Analysis API.
+func (c ContainerAnalysis) Close() error {
+	return c.client.Close()
+}
+
+// Ready returns an error if the connection to the Container Analysis API is failing or closed.
+// It only reads the state of the connection, so it's cheap enough for readiness probes.
+func (c ContainerAnalysis) Ready() error {
+	switch state := c.client.Connection().GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return fmt.Errorf("connection to the Container Analysis API is %s", state)
+	}
+	return nil
+}
+
 // GetVulnerabilites gets Package Vulnerabilities Occurrences for a specified image.
 func (c ContainerAnalysis) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
 	occs, err := c.fetchOccurrence(containerImage, PkgVulnerability)
@@ -66,7 +90,7 @@ func (c ContainerAnalysis) GetVulnerabilities(containerImage string) ([]metadata
 	}
 	vulnz := []metadata.Vulnerability{}
 	for _, occ := range occs {
-		vulnz = append(vulnz, GetVulnerabilityFromOccurence(occ))
+		vulnz = append(vulnz, GetVulnerabilitiesFromOccurence(occ)...)
 	}
 	return vulnz, nil
 }
@@ -103,32 +127,91 @@ func (c ContainerAnalysis) fetchOccurrence(containerImage string, kind string) (
 			break
 		}
 		if err != nil {
-			return nil, err
+			return nil, backendError(err)
 		}
 		occs = append(occs, occ)
 	}
 	return occs, nil
 }
 
-func GetVulnerabilityFromOccurence(occ *containeranalysispb.Occurrence) metadata.Vulnerability {
+// backendError wraps err in a metadata.BackendError if the Container Analysis API
+// failed or couldn't be reached, rather than rejecting the request
+func backendError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return &metadata.BackendError{Err: err}
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.Internal, codes.Unknown, codes.Canceled:
+		return &metadata.BackendError{Err: err}
+	}
+	return err
+}
+
+// GetVulnerabilitiesFromOccurence returns a vulnerability for each package affected by
+// a vulnerability occurrence, or a single vulnerability without a package if there are none.
+func GetVulnerabilitiesFromOccurence(occ *containeranalysispb.Occurrence) []metadata.Vulnerability {
 	vulnDetails := occ.GetDetails().(*containeranalysispb.Occurrence_VulnerabilityDetails).VulnerabilityDetails
-	hasFixAvailable := isFixAvaliable(vulnDetails.GetPackageIssue())
 	vulnerability := metadata.Vulnerability{
 		Severity:        containeranalysispb.VulnerabilityType_Severity_name[int32(vulnDetails.Severity)],
-		HasFixAvailable: hasFixAvailable,
+		HasFixAvailable: true,
 		CVE:             occ.GetNoteName(),
+		CVSSScore:       cvssScore(vulnDetails.GetCvssScore()),
+		CreateTime:      occurrenceTime(occ.GetCreateTime()),
+		UpdateTime:      occurrenceTime(occ.GetUpdateTime()),
 	}
-	return vulnerability
+	pis := vulnDetails.GetPackageIssue()
+	if len(pis) == 0 {
+		return []metadata.Vulnerability{vulnerability}
+	}
+	vulnz := make([]metadata.Vulnerability, len(pis))
+	for i, pi := range pis {
+		v := vulnerability
+		v.HasFixAvailable = isFixAvaliable(pi)
+		v.Package = pi.GetAffectedLocation().GetPackage()
+		v.Version = formatVersion(pi.GetAffectedLocation().GetVersion())
+		vulnz[i] = v
+	}
+	return vulnz
 }
 
-func isFixAvaliable(pis []*containeranalysispb.VulnerabilityType_PackageIssue) bool {
-	for _, pi := range pis {
-		if pi.GetFixedLocation().GetVersion().Kind == containeranalysispb.VulnerabilityType_Version_MAXIMUM {
-			// If FixedLocation.Version.Kind = MAXIMUM then no fix is available. Return false
-			return false
-		}
+// occurrenceTime converts a timestamp of an occurrence, returning the zero time if it's unset or invalid
+func occurrenceTime(ts *timestamp.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
 	}
-	return true
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		glog.Warningf("invalid occurrence timestamp %v: %v", ts, err)
+		return time.Time{}
+	}
+	return t
+}
+
+// cvssScore rounds a CVSS score to its single decimal, which float32 can't represent exactly
+func cvssScore(score float32) float64 {
+	return math.Round(float64(score)*10) / 10
+}
+
+func isFixAvaliable(pi *containeranalysispb.VulnerabilityType_PackageIssue) bool {
+	// If FixedLocation.Version.Kind = MAXIMUM then no fix is available.
+	return pi.GetFixedLocation().GetVersion().GetKind() != containeranalysispb.VulnerabilityType_Version_MAXIMUM
+}
+
+// formatVersion returns a version as [epoch:]name[-revision], or "" if it isn't a normal version
+func formatVersion(v *containeranalysispb.VulnerabilityType_Version) string {
+	if v.GetKind() != containeranalysispb.VulnerabilityType_Version_NORMAL || v.GetName() == "" {
+		return ""
+	}
+	s := v.GetName()
+	if v.GetRevision() != "" {
+		s += "-" + v.GetRevision()
+	}
+	if v.GetEpoch() != 0 {
+		s = fmt.Sprintf("%d:%s", v.GetEpoch(), s)
+	}
+	return s
 }
 
 func isValidImageOnGCR(containerImage string) bool {
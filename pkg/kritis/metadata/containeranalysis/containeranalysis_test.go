@@ -17,12 +17,17 @@ limitations under the License.
 package containeranalysis
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
 	"github.com/grafeas/kritis/pkg/kritis/testutil"
 	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var tcGetVuln = []struct {
@@ -39,6 +44,8 @@ var tcGetVuln = []struct {
 			CVE:             "CVE-1",
 			Severity:        "LOW",
 			HasFixAvailable: false,
+			Package:         "openssl",
+			Version:         "1:1.1.0f-3",
 		},
 	},
 	{"fix not available", containeranalysispb.VulnerabilityType_MEDIUM,
@@ -48,11 +55,13 @@ var tcGetVuln = []struct {
 			CVE:             "CVE-2",
 			Severity:        "MEDIUM",
 			HasFixAvailable: true,
+			Package:         "openssl",
+			Version:         "1:1.1.0f-3",
 		},
 	},
 }
 
-func TestGetVulnerabilityFromOccurence(t *testing.T) {
+func TestGetVulnerabilitiesFromOccurence(t *testing.T) {
 	for _, tc := range tcGetVuln {
 		t.Run(tc.name, func(t *testing.T) {
 			vulnDetails := &containeranalysispb.Occurrence_VulnerabilityDetails{
@@ -60,7 +69,14 @@ func TestGetVulnerabilityFromOccurence(t *testing.T) {
 					Severity: tc.severity,
 					PackageIssue: []*containeranalysispb.VulnerabilityType_PackageIssue{
 						{
-							AffectedLocation: &containeranalysispb.VulnerabilityType_VulnerabilityLocation{},
+							AffectedLocation: &containeranalysispb.VulnerabilityType_VulnerabilityLocation{
+								Package: "openssl",
+								Version: &containeranalysispb.VulnerabilityType_Version{
+									Epoch:    1,
+									Name:     "1.1.0f",
+									Revision: "3",
+								},
+							},
 							FixedLocation: &containeranalysispb.VulnerabilityType_VulnerabilityLocation{
 								Version: &containeranalysispb.VulnerabilityType_Version{
 									Kind: tc.fixKind,
@@ -74,14 +90,71 @@ func TestGetVulnerabilityFromOccurence(t *testing.T) {
 				Details:  vulnDetails,
 			}
 
-			actualVuln := GetVulnerabilityFromOccurence(occ)
-			if !reflect.DeepEqual(actualVuln, tc.expectedVul) {
+			actualVuln := GetVulnerabilitiesFromOccurence(occ)
+			if !reflect.DeepEqual(actualVuln, []metadata.Vulnerability{tc.expectedVul}) {
 				t.Fatalf("Expected \n%v\nGot \n%v", tc.expectedVul, actualVuln)
 			}
 		})
 	}
 }
 
+func TestGetVulnerabilitiesFromOccurencePerPackage(t *testing.T) {
+	created := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue := func(pkg string, fixKind containeranalysispb.VulnerabilityType_Version_VersionKind) *containeranalysispb.VulnerabilityType_PackageIssue {
+		return &containeranalysispb.VulnerabilityType_PackageIssue{
+			AffectedLocation: &containeranalysispb.VulnerabilityType_VulnerabilityLocation{
+				Package: pkg,
+				Version: &containeranalysispb.VulnerabilityType_Version{Name: "1.0"},
+			},
+			FixedLocation: &containeranalysispb.VulnerabilityType_VulnerabilityLocation{
+				Version: &containeranalysispb.VulnerabilityType_Version{Kind: fixKind},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		issues   []*containeranalysispb.VulnerabilityType_PackageIssue
+		expected []metadata.Vulnerability
+	}{
+		{
+			name: "no package issues",
+			expected: []metadata.Vulnerability{
+				{CVE: "CVE-1", Severity: "HIGH", CVSSScore: 9.8, CreateTime: created, HasFixAvailable: true},
+			},
+		},
+		{
+			name: "several packages",
+			issues: []*containeranalysispb.VulnerabilityType_PackageIssue{
+				issue("openssl", containeranalysispb.VulnerabilityType_Version_NORMAL),
+				issue("libssl", containeranalysispb.VulnerabilityType_Version_MAXIMUM),
+			},
+			expected: []metadata.Vulnerability{
+				{CVE: "CVE-1", Severity: "HIGH", CVSSScore: 9.8, CreateTime: created, HasFixAvailable: true, Package: "openssl", Version: "1.0"},
+				{CVE: "CVE-1", Severity: "HIGH", CVSSScore: 9.8, CreateTime: created, HasFixAvailable: false, Package: "libssl", Version: "1.0"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			occ := &containeranalysispb.Occurrence{
+				NoteName:   "CVE-1",
+				CreateTime: &timestamp.Timestamp{Seconds: created.Unix()},
+				Details: &containeranalysispb.Occurrence_VulnerabilityDetails{
+					VulnerabilityDetails: &containeranalysispb.VulnerabilityType_VulnerabilityDetails{
+						Severity:     containeranalysispb.VulnerabilityType_HIGH,
+						CvssScore:    9.8,
+						PackageIssue: tc.issues,
+					},
+				},
+			}
+			actual := GetVulnerabilitiesFromOccurence(occ)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Expected \n%v\nGot \n%v", tc.expected, actual)
+			}
+		})
+	}
+}
+
 func Test_isRegistryGCR(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -117,6 +190,41 @@ func Test_isRegistryGCR(t *testing.T) {
 	}
 }
 
+func Test_backendError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		backend bool
+	}{
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "timeout"), true},
+		{"quota", status.Error(codes.ResourceExhausted, "quota"), true},
+		{"not a status", errors.New("transport is closing"), true},
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad filter"), false},
+		{"permission denied", status.Error(codes.PermissionDenied, "denied"), false},
+		{"not found", status.Error(codes.NotFound, "no project"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ok := backendError(test.err).(*metadata.BackendError)
+			if ok != test.backend {
+				t.Errorf("expected backend error %v, got %v", test.backend, ok)
+			}
+		})
+	}
+}
+
+func TestGetVulnerabilitiesInvalidImage(t *testing.T) {
+	c := ContainerAnalysis{}
+	_, err := c.GetVulnerabilities("index.docker.io/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if err == nil {
+		t.Fatal("expected error for an image outside GCR")
+	}
+	if _, ok := err.(*metadata.BackendError); ok {
+		t.Errorf("an image outside GCR must not be a backend error, got %v", err)
+	}
+}
+
 func TestGetProjectFromNoteRef(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"time"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// Instrumented returns a MetadataFetcher which records the latency and errors
+// of every call to f as metrics tagged with backend
+func Instrumented(f MetadataFetcher, backend string) MetadataFetcher {
+	return instrumentedFetcher{f: f, backend: backend}
+}
+
+type instrumentedFetcher struct {
+	f       MetadataFetcher
+	backend string
+}
+
+func (i instrumentedFetcher) record(method string, start time.Time, err error) {
+	metrics.RecordBackendCall(i.backend, method, time.Since(start), err)
+}
+
+func (i instrumentedFetcher) GetVulnerabilities(containerImage string) ([]Vulnerability, error) {
+	start := time.Now()
+	vulnz, err := i.f.GetVulnerabilities(containerImage)
+	i.record("GetVulnerabilities", start, err)
+	return vulnz, err
+}
+
+func (i instrumentedFetcher) CreateAttestationOccurence(note *containeranalysispb.Note,
+	containerImage string,
+	pgpSigningKey *secrets.PGPSigningSecret) (*containeranalysispb.Occurrence, error) {
+	start := time.Now()
+	occ, err := i.f.CreateAttestationOccurence(note, containerImage, pgpSigningKey)
+	i.record("CreateAttestationOccurence", start, err)
+	return occ, err
+}
+
+func (i instrumentedFetcher) GetAttestationNote(aa *kritisv1beta1.AttestationAuthority) (*containeranalysispb.Note, error) {
+	start := time.Now()
+	note, err := i.f.GetAttestationNote(aa)
+	i.record("GetAttestationNote", start, err)
+	return note, err
+}
+
+func (i instrumentedFetcher) CreateAttestationNote(aa *kritisv1beta1.AttestationAuthority) (*containeranalysispb.Note, error) {
+	start := time.Now()
+	note, err := i.f.CreateAttestationNote(aa)
+	i.record("CreateAttestationNote", start, err)
+	return note, err
+}
+
+func (i instrumentedFetcher) GetAttestations(containerImage string) ([]PGPAttestation, error) {
+	start := time.Now()
+	attestations, err := i.f.GetAttestations(containerImage)
+	i.record("GetAttestations", start, err)
+	return attestations, err
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package metadata
 
 import (
+	"time"
+
 	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/secrets"
 	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
@@ -41,6 +43,15 @@ type Vulnerability struct {
 	Severity        string
 	HasFixAvailable bool
 	CVE             string
+	// CVSSScore is the CVSS base score of the vulnerability, 0 if unknown
+	CVSSScore float64
+	// Package and Version are the affected package and its version, if known
+	Package string
+	Version string
+	// CreateTime is when the vulnerability was first seen on the image, and UpdateTime
+	// when it last changed, e.g. because a fix became available. Zero if unknown.
+	CreateTime time.Time
+	UpdateTime time.Time
 }
 
 // PGPAttestation represents the Signature and the Singer Key Id from the
@@ -0,0 +1,211 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the OpenCensus measures and views of kritis.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// KeyKind is the kind of the reviewed object
+	KeyKind, _ = tag.NewKey("kind")
+	// KeyNamespace is the namespace of the reviewed object
+	KeyNamespace, _ = tag.NewKey("namespace")
+	// KeyPolicy is the name of an ImageSecurityPolicy
+	KeyPolicy, _ = tag.NewKey("policy")
+	// KeyOutcome is the outcome of an admission decision
+	KeyOutcome, _ = tag.NewKey("outcome")
+	// KeyType is the type of a violation
+	KeyType, _ = tag.NewKey("type")
+	// KeySeverity is the severity of the vulnerability of a violation
+	KeySeverity, _ = tag.NewKey("severity")
+	// KeyBackend is the metadata backend, e.g. containeranalysis
+	KeyBackend, _ = tag.NewKey("backend")
+	// KeyMethod is the MetadataFetcher method called
+	KeyMethod, _ = tag.NewKey("method")
+	// KeyResult is the result of a metadata cache lookup
+	KeyResult, _ = tag.NewKey("result")
+)
+
+// Outcomes of an admission decision
+const (
+	OutcomeAllowed    = "allowed"
+	OutcomeDenied     = "denied"
+	OutcomeWarned     = "warned"
+	OutcomeAudited    = "audited"
+	OutcomeFailedOpen = "failed_open"
+	OutcomeBreakglass = "breakglass"
+	OutcomeError      = "error"
+)
+
+// Results of a metadata cache lookup
+const (
+	CacheHit   = "hit"
+	CacheStale = "stale"
+	CacheMiss  = "miss"
+	// CacheUncacheable is the result of looking up an image referenced by tag
+	CacheUncacheable = "uncacheable"
+)
+
+var (
+	// AdmissionDecisions counts the decisions of the admission webhook, one per policy reviewed
+	AdmissionDecisions = stats.Int64("kritis/admission_decisions", "Admission decisions, one per image security policy reviewed", stats.UnitDimensionless)
+	// Violations counts the policy violations found, at admission and by the cron job
+	Violations = stats.Int64("kritis/violations", "Image security policy violations found", stats.UnitDimensionless)
+	// BreakglassUses counts the objects admitted with a breakglass
+	BreakglassUses = stats.Int64("kritis/breakglass_uses", "Objects admitted with a breakglass", stats.UnitDimensionless)
+	// FailOpenAdmissions counts the images admitted without being reviewed by a policy,
+	// because of a metadata backend error and the policy failing open
+	FailOpenAdmissions = stats.Int64("kritis/fail_open_admissions", "Images admitted because a policy failed open", stats.UnitDimensionless)
+	// CronCycleDuration is the time taken by a cycle of the cron job
+	CronCycleDuration = stats.Float64("kritis/cron_cycle_duration_seconds", "Duration of the cron job cycles", "s")
+	// CronPodsFlagged is the number of pods in violation found by the last cycle of the cron job
+	CronPodsFlagged = stats.Int64("kritis/cron_pods_flagged", "Pods in violation found by the last cron job cycle", stats.UnitDimensionless)
+	// BackendLatency is the latency of MetadataFetcher calls
+	BackendLatency = stats.Float64("kritis/backend_latency_seconds", "Latency of metadata backend calls", "s")
+	// BackendErrors counts the MetadataFetcher calls which failed
+	BackendErrors = stats.Int64("kritis/backend_errors", "Failed metadata backend calls", stats.UnitDimensionless)
+	// AuditRecordsDropped counts the audit records dropped because the audit queue was full
+	AuditRecordsDropped = stats.Int64("kritis/audit_records_dropped", "Audit records dropped because the queue was full", stats.UnitDimensionless)
+	// CacheLookups counts the lookups of the metadata cache
+	CacheLookups = stats.Int64("kritis/metadata_cache_lookups", "Metadata cache lookups", stats.UnitDimensionless)
+	// ServingCertificateExpiry is when the TLS certificate served by kritis-server expires
+	ServingCertificateExpiry = stats.Float64("kritis/serving_certificate_expiry_timestamp_seconds", "Unix time at which the serving certificate expires", "s")
+)
+
+// latencyBuckets are the bucket bounds of latencies, in seconds
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Views are the views of every kritis measure
+var Views = []*view.View{
+	countView(AdmissionDecisions, KeyKind, KeyNamespace, KeyPolicy, KeyOutcome),
+	countView(Violations, KeyType, KeySeverity),
+	countView(BreakglassUses, KeyKind, KeyNamespace),
+	countView(FailOpenAdmissions, KeyNamespace, KeyPolicy),
+	{
+		Name:        CronCycleDuration.Name(),
+		Description: CronCycleDuration.Description(),
+		Measure:     CronCycleDuration,
+		Aggregation: view.Distribution(latencyBuckets...),
+	},
+	{
+		Name:        CronPodsFlagged.Name(),
+		Description: CronPodsFlagged.Description(),
+		Measure:     CronPodsFlagged,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        BackendLatency.Name(),
+		Description: BackendLatency.Description(),
+		Measure:     BackendLatency,
+		Aggregation: view.Distribution(latencyBuckets...),
+		TagKeys:     []tag.Key{KeyBackend, KeyMethod},
+	},
+	countView(BackendErrors, KeyBackend, KeyMethod),
+	countView(CacheLookups, KeyMethod, KeyResult),
+	countView(AuditRecordsDropped),
+	{
+		Name:        ServingCertificateExpiry.Name(),
+		Description: ServingCertificateExpiry.Description(),
+		Measure:     ServingCertificateExpiry,
+		Aggregation: view.LastValue(),
+	},
+}
+
+func countView(m *stats.Int64Measure, keys ...tag.Key) *view.View {
+	return &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.Count(),
+		TagKeys:     keys,
+	}
+}
+
+func init() {
+	if err := view.Register(Views...); err != nil {
+		glog.Errorf("error registering metrics views: %v", err)
+	}
+}
+
+// RecordAdmissionDecision records the outcome of policy for an object of kind in namespace
+func RecordAdmissionDecision(kind, namespace, policy, outcome string) {
+	record(AdmissionDecisions.M(1),
+		tag.Upsert(KeyKind, kind), tag.Upsert(KeyNamespace, namespace),
+		tag.Upsert(KeyPolicy, policy), tag.Upsert(KeyOutcome, outcome))
+}
+
+// RecordViolation records a violation of the given type, for a vulnerability of severity if any
+func RecordViolation(violationType, severity string) {
+	record(Violations.M(1), tag.Upsert(KeyType, violationType), tag.Upsert(KeySeverity, severity))
+}
+
+// RecordBreakglass records an object of kind in namespace admitted with a breakglass
+func RecordBreakglass(kind, namespace string) {
+	record(BreakglassUses.M(1), tag.Upsert(KeyKind, kind), tag.Upsert(KeyNamespace, namespace))
+}
+
+// RecordFailOpen records an image admitted because policy failed open in namespace
+func RecordFailOpen(namespace, policy string) {
+	record(FailOpenAdmissions.M(1), tag.Upsert(KeyNamespace, namespace), tag.Upsert(KeyPolicy, policy))
+}
+
+// RecordCronCycle records a cron job cycle which took d and found flagged pods in violation
+func RecordCronCycle(d time.Duration, flagged int) {
+	record(CronCycleDuration.M(d.Seconds()))
+	record(CronPodsFlagged.M(int64(flagged)))
+}
+
+// RecordBackendCall records a call to method of the metadata backend which took d and returned err
+func RecordBackendCall(backend, method string, d time.Duration, err error) {
+	mutators := []tag.Mutator{tag.Upsert(KeyBackend, backend), tag.Upsert(KeyMethod, method)}
+	record(BackendLatency.M(d.Seconds()), mutators...)
+	if err != nil {
+		record(BackendErrors.M(1), mutators...)
+	}
+}
+
+// RecordCacheLookup records a lookup of method in the metadata cache, and its result
+func RecordCacheLookup(method, result string) {
+	record(CacheLookups.M(1), tag.Upsert(KeyMethod, method), tag.Upsert(KeyResult, result))
+}
+
+// RecordAuditDropped records an audit record dropped because the audit queue was full
+func RecordAuditDropped() {
+	record(AuditRecordsDropped.M(1))
+}
+
+// RecordServingCertificateExpiry records the expiry of the serving certificate loaded
+func RecordServingCertificateExpiry(t time.Time) {
+	record(ServingCertificateExpiry.M(float64(t.Unix())))
+}
+
+func record(m stats.Measurement, mutators ...tag.Mutator) {
+	ctx, err := tag.New(context.Background(), mutators...)
+	if err != nil {
+		glog.Errorf("error tagging measurement %s: %v", m.Measure().Name(), err)
+		return
+	}
+	stats.Record(ctx, m)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestRecordFailOpen(t *testing.T) {
+	RecordFailOpen("ns", "isp")
+	RecordFailOpen("ns", "isp")
+	// Measurements are aggregated asynchronously
+	var rows []*view.Row
+	for i := 0; i < 100 && len(rows) == 0; i++ {
+		var err error
+		if rows, err = view.RetrieveData(FailOpenAdmissions.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got rows %v, expected 1", rows)
+	}
+	if count := rows[0].Data.(*view.CountData).Value; count != 2 {
+		t.Errorf("got count %d, expected 2", count)
+	}
+}
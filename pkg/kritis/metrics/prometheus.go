@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Handler serves Views in the Prometheus text exposition format.
+// The vendored dependencies have no Prometheus client, so views are
+// retrieved from OpenCensus on every scrape and rendered here.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		for _, v := range Views {
+			rows, err := view.RetrieveData(v.Name)
+			if err != nil {
+				glog.Errorf("error retrieving metrics view %s: %v", v.Name, err)
+				continue
+			}
+			writeView(&buf, v, rows)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// writeView writes the rows of v, sorted by labels so that scrapes are stable
+func writeView(w io.Writer, v *view.View, rows []*view.Row) {
+	name := metricName(v.Name)
+	metricType := "gauge"
+	switch v.Aggregation.Type {
+	case view.AggTypeCount:
+		name += "_total"
+		metricType = "counter"
+	case view.AggTypeDistribution:
+		metricType = "histogram"
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, v.Description)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+
+	type sample struct {
+		labels string
+		data   view.AggregationData
+	}
+	samples := []sample{}
+	for _, r := range rows {
+		samples = append(samples, sample{labels: labels(v.TagKeys, r.Tags), data: r.Data})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+
+	for _, s := range samples {
+		switch d := s.data.(type) {
+		case *view.CountData:
+			fmt.Fprintf(w, "%s%s %d\n", name, braces(s.labels), d.Value)
+		case *view.SumData:
+			fmt.Fprintf(w, "%s%s %s\n", name, braces(s.labels), formatFloat(d.Value))
+		case *view.LastValueData:
+			fmt.Fprintf(w, "%s%s %s\n", name, braces(s.labels), formatFloat(d.Value))
+		case *view.DistributionData:
+			var cumulative int64
+			for i, bound := range v.Aggregation.Buckets {
+				cumulative += d.CountPerBucket[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(s.labels, `le="`+formatFloat(bound)+`"`)), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(s.labels, `le="+Inf"`)), d.Count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(s.labels), formatFloat(d.Sum()))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, braces(s.labels), d.Count)
+		}
+	}
+}
+
+// metricName turns a view name such as kritis/violations into a Prometheus metric name
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// labels renders a label for every key of the view, empty if the row has no such tag
+func labels(keys []tag.Key, tags []tag.Tag) string {
+	values := map[string]string{}
+	for _, t := range tags {
+		values[t.Key.Name()] = t.Value
+	}
+	var l []string
+	for _, k := range keys {
+		l = append(l, fmt.Sprintf("%s=%s", k.Name(), strconv.Quote(values[k.Name()])))
+	}
+	return strings.Join(l, ",")
+}
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
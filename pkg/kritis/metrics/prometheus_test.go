@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	RecordAdmissionDecision("Pod", "prometheus", "isp", OutcomeDenied)
+	RecordAdmissionDecision("Pod", "prometheus", "isp", OutcomeDenied)
+	RecordAdmissionDecision("Pod", "prometheus", "", OutcomeBreakglass)
+	RecordBackendCall("prometheus", "GetVulnerabilities", 30*time.Millisecond, nil)
+	RecordBackendCall("prometheus", "GetVulnerabilities", 2*time.Second, fmt.Errorf("unavailable"))
+	RecordCronCycle(time.Second, 3)
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"# TYPE kritis_admission_decisions_total counter",
+		`kritis_admission_decisions_total{kind="Pod",namespace="prometheus",outcome="denied",policy="isp"} 2`,
+		`kritis_admission_decisions_total{kind="Pod",namespace="prometheus",outcome="breakglass",policy=""} 1`,
+		"# TYPE kritis_backend_latency_seconds histogram",
+		`kritis_backend_latency_seconds_bucket{backend="prometheus",method="GetVulnerabilities",le="0.025"} 0`,
+		`kritis_backend_latency_seconds_bucket{backend="prometheus",method="GetVulnerabilities",le="0.05"} 1`,
+		`kritis_backend_latency_seconds_bucket{backend="prometheus",method="GetVulnerabilities",le="2.5"} 2`,
+		`kritis_backend_latency_seconds_bucket{backend="prometheus",method="GetVulnerabilities",le="+Inf"} 2`,
+		`kritis_backend_latency_seconds_sum{backend="prometheus",method="GetVulnerabilities"} 2.03`,
+		`kritis_backend_latency_seconds_count{backend="prometheus",method="GetVulnerabilities"} 2`,
+		`kritis_backend_errors_total{backend="prometheus",method="GetVulnerabilities"} 1`,
+		"# TYPE kritis_cron_pods_flagged gauge",
+		"kritis_cron_pods_flagged 3",
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(body), e+"\n") {
+			t.Errorf("expected %q in metrics:\n%s", e, body)
+		}
+	}
+}
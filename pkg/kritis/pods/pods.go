@@ -21,7 +21,6 @@ import (
 
 	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	patch "k8s.io/apimachinery/pkg/util/strategicpatch"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -32,14 +31,54 @@ var (
 	patchFunction = applyPatch
 )
 
+// Pod is a pod along with the images of its ephemeral containers,
+// which the vendored API types drop when decoding it
+type Pod struct {
+	corev1.Pod
+	EphemeralImages []string
+}
+
+// Images returns a list of images in the pod, including its ephemeral containers
+func (p Pod) Images() []string {
+	return append(Images(p.Pod), p.EphemeralImages...)
+}
+
 // Pods returns a list of pods in a namespace
-func Pods(namespace string) ([]corev1.Pod, error) {
+func Pods(namespace string) ([]Pod, error) {
 	clientset, err := kubernetesutil.GetClientset()
 	if err != nil {
 		return nil, err
 	}
-	pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{})
-	return pods.Items, err
+	// The list is decoded here rather than by the typed client, to keep ephemeral containers
+	raw, err := clientset.CoreV1().RESTClient().Get().Namespace(namespace).Resource("pods").DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	return decodePods(raw)
+}
+
+// decodePods decodes a JSON encoded pod list
+func decodePods(raw []byte) ([]Pod, error) {
+	list := corev1.PodList{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	specs := struct {
+		Items []struct {
+			Spec ephemeralContainers `json:"spec"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return nil, err
+	}
+	pods := make([]Pod, len(list.Items))
+	for i, p := range list.Items {
+		pods[i] = Pod{Pod: p}
+		for _, c := range specs.Items[i].Spec.EphemeralContainers {
+			pods[i].EphemeralImages = append(pods[i].EphemeralImages, c.Image)
+		}
+	}
+	return pods, nil
 }
 
 // Images returns a list of images in a pod
@@ -54,6 +93,30 @@ func Images(pod corev1.Pod) []string {
 	return images
 }
 
+// ephemeralContainers holds the ephemeral containers of a pod spec, added in
+// Kubernetes 1.16, which the vendored API types predate. It also decodes the
+// EphemeralContainers object of the pods/ephemeralcontainers subresource.
+type ephemeralContainers struct {
+	EphemeralContainers []corev1.Container `json:"ephemeralContainers,omitempty"`
+}
+
+// EphemeralImages returns the images of the ephemeral containers in a JSON encoded
+// pod spec or EphemeralContainers object
+func EphemeralImages(raw []byte) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	ec := ephemeralContainers{}
+	if err := json.Unmarshal(raw, &ec); err != nil {
+		return nil, err
+	}
+	images := []string{}
+	for _, c := range ec.EphemeralContainers {
+		images = append(images, c.Image)
+	}
+	return images, nil
+}
+
 func getPatch(modifiedPod *corev1.Pod, originalJSON []byte) ([]byte, error) {
 	modifiedJSON, err := json.Marshal(modifiedPod)
 	if err != nil {
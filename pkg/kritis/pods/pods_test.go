@@ -48,6 +48,45 @@ func Test_Images(t *testing.T) {
 	testutil.CheckErrorAndDeepEqual(t, false, nil, expected, actual)
 }
 
+func Test_EphemeralImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected []string
+	}{
+		{"empty", "", nil},
+		{"pod spec", `{"containers":[{"image":"image1"}],"ephemeralContainers":[{"name":"debug","image":"image2","targetContainerName":"app"}]}`, []string{"image2"}},
+		{"no ephemeral containers", `{"containers":[{"image":"image1"}]}`, []string{}},
+		{"subresource", `{"kind":"EphemeralContainers","ephemeralContainers":[{"image":"image3"}]}`, []string{"image3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := EphemeralImages([]byte(test.raw))
+			testutil.CheckErrorAndDeepEqual(t, false, err, test.expected, actual)
+		})
+	}
+}
+
+func Test_decodePods(t *testing.T) {
+	raw := `{"kind":"PodList","items":[` +
+		`{"metadata":{"name":"app"},"spec":{"containers":[{"image":"image1"}]}},` +
+		`{"metadata":{"name":"debugged"},"spec":{"initContainers":[{"image":"image2"}],"containers":[{"image":"image3"}],` +
+		`"ephemeralContainers":[{"name":"debug","image":"image4","targetContainerName":"app"}]}}]}`
+	pods, err := decodePods([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual [][]string
+	for _, p := range pods {
+		actual = append(actual, p.Images())
+	}
+	expected := [][]string{{"image1"}, {"image2", "image3", "image4"}}
+	testutil.CheckErrorAndDeepEqual(t, false, nil, expected, actual)
+	if pods[1].Name != "debugged" {
+		t.Errorf("got pod %s, expected debugged", pods[1].Name)
+	}
+}
+
 func Test_AddPatch(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -18,59 +18,279 @@ package review
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/metrics"
 	"github.com/grafeas/kritis/pkg/kritis/util"
 	"github.com/grafeas/kritis/pkg/kritis/violation"
 	"k8s.io/api/core/v1"
 )
 
 type Reviewer struct {
-	client   metadata.MetadataFetcher
-	vs       violation.Strategy
-	validate securitypolicy.ValidateFunc
+	client        metadata.MetadataFetcher
+	vs            violation.Strategy
+	validate      securitypolicy.ValidateFunc
+	failurePolicy v1beta1.FailurePolicy
+	dryRun        bool
+	// ephemeral are the ephemeral containers of the reviewed pod, which v1.Pod predates
+	ephemeral []v1.Container
+}
+
+// ImageViolation is a violation of a policy by an image
+type ImageViolation struct {
+	securitypolicy.SecurityPolicyViolation
+	Image string
+	// Container is the field path of the container running the image, e.g. spec.containers{app}
+	// It is empty if the image isn't reviewed as part of a pod
+	Container         string
+	Policy            string
+	EnforcementAction v1beta1.EnforcementAction
+}
+
+// FailOpen is a policy which couldn't be evaluated for an image because of a
+// metadata backend error, and which was skipped as its failure policy is open
+type FailOpen struct {
+	Image  string
+	Policy string
+	Err    error
+}
+
+// ViolationError is returned by Review when images violate policies, or when
+// policies failed open. It holds the violations of every image against every policy.
+type ViolationError struct {
+	Violations []ImageViolation
+	FailedOpen []FailOpen
+}
+
+// WithAction returns the violations of policies with the given enforcement action
+func (e *ViolationError) WithAction(action v1beta1.EnforcementAction) []ImageViolation {
+	var violations []ImageViolation
+	for _, v := range e.Violations {
+		if v.EnforcementAction == action {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// Error returns a concise summary of the images in violation
+func (e *ViolationError) Error() string {
+	var unqualified, violating []string
+	seen := map[string]bool{}
+	for _, v := range e.Violations {
+		if seen[v.Image] {
+			continue
+		}
+		seen[v.Image] = true
+		if v.Violation == securitypolicy.UnqualifiedImageViolation {
+			unqualified = append(unqualified, v.Image)
+		} else {
+			violating = append(violating, v.Image)
+		}
+	}
+	var msgs []string
+	for _, image := range unqualified {
+		msgs = append(msgs, fmt.Sprintf("%s is not a fully qualified image", image))
+	}
+	if len(violating) != 0 {
+		msgs = append(msgs, fmt.Sprintf("found violations in %s", strings.Join(violating, ", ")))
+	}
+	for _, f := range e.FailedOpen {
+		msgs = append(msgs, fmt.Sprintf("image security policy %s failed open for %s: %v", f.Policy, f.Image, f.Err))
+	}
+	return strings.Join(msgs, "; ")
 }
 
 func New(client metadata.MetadataFetcher, vs violation.Strategy, validate securitypolicy.ValidateFunc) Reviewer {
 	return Reviewer{
-		client:   client,
-		vs:       vs,
-		validate: validate,
+		client:        client,
+		vs:            vs,
+		validate:      validate,
+		failurePolicy: v1beta1.FailurePolicyClosed,
 	}
 }
 
+// WithFailurePolicy returns a copy of the reviewer which handles metadata backend
+// errors with the given failure policy, unless a policy overrides it
+func (r Reviewer) WithFailurePolicy(p v1beta1.FailurePolicy) Reviewer {
+	r.failurePolicy = p
+	return r
+}
+
+// WithEphemeralContainers returns a copy of the reviewer which reports the violations
+// of images in the ephemeral containers of the reviewed pod against them
+func (r Reviewer) WithEphemeralContainers(containers []v1.Container) Reviewer {
+	r.ephemeral = containers
+	return r
+}
+
+// maxConcurrentImages bounds the images reviewed in parallel, and so the
+// concurrent lookups of the metadata backend
+const maxConcurrentImages = 8
+
+// imageReview is the outcome of reviewing an image against every policy
+type imageReview struct {
+	violations []ImageViolation
+	failedOpen []FailOpen
+	// enforced are the violations of policies which aren't in audit mode
+	enforced []securitypolicy.SecurityPolicyViolation
+	err      error
+}
+
+// DryRun returns a copy of the reviewer which only reports violations: they
+// aren't handled by its violation strategy, nor recorded as metrics
+func (r Reviewer) DryRun() Reviewer {
+	r.dryRun = true
+	return r
+}
+
 // Review reviews a set of images against a set of policies
-// Returns error if violations are found and handles them as per violation strategy
+// Returns a *ViolationError holding every violation found, after handling them as per violation strategy.
+// Violations of policies in audit mode are only logged, and aren't passed to the violation strategy.
+// Policies which fail open on a metadata backend error are skipped, and reported in the *ViolationError.
+// Distinct images are reviewed concurrently, and the metadata of each is fetched once for all policies.
 func (r Reviewer) Review(images []string, isps []v1beta1.ImageSecurityPolicy, pod *v1.Pod) error {
 	images = util.RemoveGloballyWhitelistedImages(images)
 	if len(images) == 0 {
 		glog.Info("images are all globally whitelisted, returning successful status", images)
 		return nil
 	}
+	images = distinct(images)
+	containers := containerPaths(pod, r.ephemeral)
+	reviews := make([]imageReview, len(images))
+	sem := make(chan struct{}, maxConcurrentImages)
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			reviews[i] = r.reviewImage(image, containers[image], isps)
+		}(i, image)
+	}
+	wg.Wait()
+
+	// Violations are handled in the order of the images, as strategies aren't safe for concurrent use
+	verr := &ViolationError{}
+	for i, image := range images {
+		ir := reviews[i]
+		if ir.err != nil {
+			return ir.err
+		}
+		verr.Violations = append(verr.Violations, ir.violations...)
+		verr.FailedOpen = append(verr.FailedOpen, ir.failedOpen...)
+		if r.dryRun {
+			continue
+		}
+		for _, v := range ir.violations {
+			metrics.RecordViolation(securitypolicy.ViolationType(v.Violation), v.Vulnerability.Severity)
+		}
+		if len(ir.enforced) == 0 {
+			continue
+		}
+		if err := r.vs.HandleViolation(image, pod, ir.enforced); err != nil {
+			return fmt.Errorf("%s. error handling violation %v", verr.Error(), err)
+		}
+	}
+	if len(verr.Violations) != 0 || len(verr.FailedOpen) != 0 {
+		return verr
+	}
+	return nil
+}
+
+// reviewImage evaluates every policy for an image, fetching its metadata once
+func (r Reviewer) reviewImage(image, container string, isps []v1beta1.ImageSecurityPolicy) imageReview {
+	var ir imageReview
+	client := &memoized{MetadataFetcher: r.client, vulnz: map[string]vulnzResult{}}
 	for _, isp := range isps {
-		for _, image := range images {
-			glog.Infof("Getting vulnz for %s", image)
-			violations, err := r.validate(isp, image, r.client)
-			if err != nil {
-				return fmt.Errorf("error validating image security policy %v", err)
+		name := securitypolicy.Name(isp)
+		violations, err := r.validate(isp, image, client)
+		if _, ok := err.(*metadata.BackendError); ok && securitypolicy.FailurePolicy(isp, r.failurePolicy) == v1beta1.FailurePolicyOpen {
+			glog.Warningf("image security policy %s/%s failed open for %s: %v", isp.Namespace, name, image, err)
+			ir.failedOpen = append(ir.failedOpen, FailOpen{Image: image, Policy: name, Err: err})
+			continue
+		}
+		if err != nil {
+			ir.err = fmt.Errorf("error validating image security policy %v", err)
+			return ir
+		}
+		action := securitypolicy.EnforcementAction(isp)
+		for _, v := range violations {
+			ir.violations = append(ir.violations, ImageViolation{
+				SecurityPolicyViolation: v,
+				Image:                   image,
+				Container:               container,
+				Policy:                  name,
+				EnforcementAction:       action,
+			})
+			if action == v1beta1.EnforcementActionAudit {
+				glog.Warningf("audit: %s violates image security policy %s/%s: %s", image, isp.Namespace, name, v.Reason)
 			}
-			if len(violations) != 0 {
-				errMsg := fmt.Sprintf("found violations in %s", image)
-				// Check if one of the violations is that the image is not fully qualified
-				for _, v := range violations {
-					if v.Violation == securitypolicy.UnqualifiedImageViolation {
-						errMsg = fmt.Sprintf("%s is not a fully qualified image", image)
-					}
-				}
-				if err := r.vs.HandleViolation(image, pod, violations); err != nil {
-					return fmt.Errorf("%s. error handling violation %v", errMsg, err)
-				}
-				return fmt.Errorf(errMsg)
+		}
+		if action != v1beta1.EnforcementActionAudit {
+			ir.enforced = append(ir.enforced, violations...)
+		}
+	}
+	return ir
+}
+
+type vulnzResult struct {
+	vulnz []metadata.Vulnerability
+	err   error
+}
+
+// memoized is a MetadataFetcher which gets the vulnerabilities of an image
+// once, however many policies evaluate them. It isn't safe for concurrent use.
+type memoized struct {
+	metadata.MetadataFetcher
+	vulnz map[string]vulnzResult
+}
+
+func (m *memoized) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
+	if r, ok := m.vulnz[containerImage]; ok {
+		return r.vulnz, r.err
+	}
+	glog.Infof("Getting vulnz for %s", containerImage)
+	vulnz, err := m.MetadataFetcher.GetVulnerabilities(containerImage)
+	m.vulnz[containerImage] = vulnzResult{vulnz, err}
+	return vulnz, err
+}
+
+// distinct returns images without duplicates, in the order they first appear
+func distinct(images []string) []string {
+	var d []string
+	seen := map[string]bool{}
+	for _, image := range images {
+		if !seen[image] {
+			seen[image] = true
+			d = append(d, image)
+		}
+	}
+	return d
+}
+
+// containerPaths maps each image of a pod, and of its ephemeral containers,
+// to the field path of the first container running it
+func containerPaths(pod *v1.Pod, ephemeral []v1.Container) map[string]string {
+	paths := map[string]string{}
+	if pod == nil {
+		return paths
+	}
+	add := func(field string, containers []v1.Container) {
+		for _, c := range containers {
+			if _, ok := paths[c.Image]; !ok {
+				paths[c.Image] = fmt.Sprintf("spec.%s{%s}", field, c.Name)
 			}
 		}
 	}
-	return nil
+	add("initContainers", pod.Spec.InitContainers)
+	add("containers", pod.Spec.Containers)
+	add("ephemeralContainers", ephemeral)
+	return paths
 }
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/testutil"
+	"github.com/grafeas/kritis/pkg/kritis/violation"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// countingFetcher counts the lookups of each image, and the lookups in flight
+type countingFetcher struct {
+	testutil.MockMetadataClient
+	mu          sync.Mutex
+	calls       map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *countingFetcher) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
+	f.mu.Lock()
+	f.calls[containerImage]++
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	f.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	return []metadata.Vulnerability{{CVE: "CVE-1", Severity: "HIGH"}}, nil
+}
+
+func TestReviewFetchesEachImageOnce(t *testing.T) {
+	var images []string
+	for i := 0; i < 2*maxConcurrentImages; i++ {
+		image := fmt.Sprintf("gcr.io/foo/image%d@sha256:0000000000000000000000000000000000000000000000000000000000000000", i)
+		images = append(images, image, image)
+	}
+	var isps []v1beta1.ImageSecurityPolicy
+	for _, name := range []string{"a", "b", "c"} {
+		isps = append(isps, v1beta1.ImageSecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1beta1.ImageSecurityPolicySpec{
+				PackageVulnerabilityRequirements: v1beta1.PackageVulnerabilityRequirements{
+					MaximumSeverity: "MEDIUM",
+				},
+			},
+		})
+	}
+	f := &countingFetcher{calls: map[string]int{}}
+	vs := &violation.MemoryStrategy{Violations: map[string]bool{}}
+	err := New(f, vs, securitypolicy.ValidateImageSecurityPolicy).Review(images, isps, nil)
+
+	verr, ok := err.(*ViolationError)
+	if !ok {
+		t.Fatalf("got error %v, expected a *ViolationError", err)
+	}
+	if got, want := len(verr.Violations), len(images)/2*len(isps); got != want {
+		t.Errorf("got %d violations, expected %d", got, want)
+	}
+	for i, v := range verr.Violations {
+		if want := images[i/len(isps)*2]; v.Image != want {
+			t.Errorf("got violation %d for %s, expected %s", i, v.Image, want)
+		}
+	}
+	for image, calls := range f.calls {
+		if calls != 1 {
+			t.Errorf("got %d lookups of %s, expected 1", calls, image)
+		}
+	}
+	if len(f.calls) != len(images)/2 {
+		t.Errorf("got lookups of %d images, expected %d", len(f.calls), len(images)/2)
+	}
+	if f.maxInFlight > maxConcurrentImages {
+		t.Errorf("got %d concurrent lookups, expected at most %d", f.maxInFlight, maxConcurrentImages)
+	}
+	if len(vs.Violations) != len(images)/2 {
+		t.Errorf("got violations handled for %d images, expected %d", len(vs.Violations), len(images)/2)
+	}
+}
+
+func TestContainerPaths(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init", Image: "init:tag"}},
+			Containers:     []v1.Container{{Name: "app", Image: "app:tag"}, {Name: "sidecar", Image: "init:tag"}},
+		},
+	}
+	ephemeral := []v1.Container{{Name: "debug", Image: "debug:tag"}, {Name: "debug-app", Image: "app:tag"}}
+	expected := map[string]string{
+		"init:tag":  "spec.initContainers{init}",
+		"app:tag":   "spec.containers{app}",
+		"debug:tag": "spec.ephemeralContainers{debug}",
+	}
+	if actual := containerPaths(pod, ephemeral); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/api/core/v1"
+)
+
+// dockerConfigEntry is a single registry entry of a docker config
+type dockerConfigEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// dockerConfigJSON is the format of a kubernetes.io/dockerconfigjson secret
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// PullSecretKeychain implements authn.Keychain with the credentials of imagePullSecrets.
+// Registries without a matching secret fall back to authn.DefaultKeychain.
+type PullSecretKeychain struct {
+	auths map[string]authn.Authenticator
+}
+
+// GetPullSecretKeychain builds a keychain from the named imagePullSecrets in namespace
+func GetPullSecretKeychain(namespace string, names []string) (*PullSecretKeychain, error) {
+	k := &PullSecretKeychain{auths: map[string]authn.Authenticator{}}
+	for _, n := range names {
+		secret, err := getSecretFunc(namespace, n)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := dockerConfigEntries(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image pull secret %s: %v", n, err)
+		}
+		for registry, entry := range entries {
+			auth, err := entry.authenticator()
+			if err != nil {
+				return nil, fmt.Errorf("invalid image pull secret %s: %v", n, err)
+			}
+			// The first secret listed for a registry wins, as it does for the kubelet
+			if _, ok := k.auths[registryHost(registry)]; !ok {
+				k.auths[registryHost(registry)] = auth
+			}
+		}
+	}
+	return k, nil
+}
+
+// Resolve implements authn.Keychain
+func (k *PullSecretKeychain) Resolve(reg name.Registry) (authn.Authenticator, error) {
+	if auth, ok := k.auths[reg.RegistryStr()]; ok {
+		return auth, nil
+	}
+	return authn.DefaultKeychain.Resolve(reg)
+}
+
+func dockerConfigEntries(secret *v1.Secret) (map[string]dockerConfigEntry, error) {
+	switch secret.Type {
+	case v1.SecretTypeDockerConfigJson:
+		cfg := dockerConfigJSON{}
+		if err := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], &cfg); err != nil {
+			return nil, err
+		}
+		return cfg.Auths, nil
+	case v1.SecretTypeDockercfg:
+		entries := map[string]dockerConfigEntry{}
+		if err := json.Unmarshal(secret.Data[v1.DockerConfigKey], &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("unsupported secret type %s", secret.Type)
+}
+
+func (e dockerConfigEntry) authenticator() (authn.Authenticator, error) {
+	if e.Username != "" {
+		return &authn.Basic{Username: e.Username, Password: e.Password}, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("auth entry is not of the form username:password")
+	}
+	return &authn.Basic{Username: parts[0], Password: parts[1]}, nil
+}
+
+// registryHost strips the scheme and path docker configs allow around a registry,
+// e.g. https://gcr.io/v1/ becomes gcr.io
+func registryHost(registry string) string {
+	if !strings.Contains(registry, "://") {
+		registry = "https://" + registry
+	}
+	u, err := url.Parse(registry)
+	if err != nil {
+		return registry
+	}
+	return u.Host
+}
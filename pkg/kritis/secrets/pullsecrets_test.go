@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var pullSecrets = map[string]*v1.Secret{
+	"json": {
+		ObjectMeta: metav1.ObjectMeta{Name: "json"},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			v1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"https://gcr.io/v1/":{"auth":%q}}}`,
+				base64.StdEncoding.EncodeToString([]byte("_json_key:secret")))),
+		},
+	},
+	"cfg": {
+		ObjectMeta: metav1.ObjectMeta{Name: "cfg"},
+		Type:       v1.SecretTypeDockercfg,
+		Data: map[string][]byte{
+			v1.DockerConfigKey: []byte(`{"quay.io":{"username":"user","password":"pass"}}`),
+		},
+	},
+	"opaque": {
+		ObjectMeta: metav1.ObjectMeta{Name: "opaque"},
+		Type:       v1.SecretTypeOpaque,
+	},
+}
+
+func TestGetPullSecretKeychain(t *testing.T) {
+	original := getSecretFunc
+	defer func() {
+		getSecretFunc = original
+	}()
+	getSecretFunc = func(namespace string, name string) (*v1.Secret, error) {
+		if s, ok := pullSecrets[name]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("secret %s not found", name)
+	}
+
+	if _, err := GetPullSecretKeychain("ns", []string{"opaque"}); err == nil {
+		t.Errorf("expected error for secret which isn't a docker config")
+	}
+	if _, err := GetPullSecretKeychain("ns", []string{"missing"}); err == nil {
+		t.Errorf("expected error for missing secret")
+	}
+
+	k, err := GetPullSecretKeychain("ns", []string{"json", "cfg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		registry string
+		expected authn.Authenticator
+	}{
+		{"gcr.io", &authn.Basic{Username: "_json_key", Password: "secret"}},
+		{"quay.io", &authn.Basic{Username: "user", Password: "pass"}},
+	}
+	for _, test := range tests {
+		t.Run(test.registry, func(t *testing.T) {
+			reg, err := name.NewRegistry(test.registry, name.WeakValidation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth, err := k.Resolve(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := auth.Authorization()
+			expected, _ := test.expected.Authorization()
+			if got != expected {
+				t.Errorf("got authorization %s, expected %s", got, expected)
+			}
+		})
+	}
+}
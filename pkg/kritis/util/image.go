@@ -0,0 +1,194 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// MatchImage reports whether image matches the whitelist pattern.
+//
+// A pattern is one of:
+//   - a full reference with a tag or digest, which matches only that exact image
+//   - a repository such as gcr.io/proj/app, which matches any tag or digest of it
+//   - a glob such as gcr.io/proj/* or gcr.io/proj/**@sha256:*, matched against
+//     the whole image, where * matches any characters except / and ** also
+//     matches /
+//
+// Patterns and images are normalized first, so that nginx, docker.io/library/nginx
+// and index.docker.io/library/nginx are the same repository. Patterns registered
+// by CompileImagePatterns are compiled once, others on every call.
+func MatchImage(pattern, image string) bool {
+	imagePatterns.RLock()
+	c, ok := imagePatterns.compiled[pattern]
+	imagePatterns.RUnlock()
+	if ok {
+		return c.pattern.Match(image)
+	}
+	return CompileImagePattern(pattern).Match(image)
+}
+
+// imagePatterns holds the compiled patterns of the loaded policies, along with
+// how many times they're in them, so that patterns no policy has are evicted
+var imagePatterns = struct {
+	sync.RWMutex
+	compiled map[string]*countedPattern
+}{compiled: map[string]*countedPattern{}}
+
+type countedPattern struct {
+	pattern *ImagePattern
+	refs    int
+}
+
+// CompileImagePatterns compiles whitelist patterns ahead of their first use, e.g.
+// when the policy they're in is loaded. They're kept until released as many times.
+func CompileImagePatterns(patterns []string) {
+	imagePatterns.Lock()
+	defer imagePatterns.Unlock()
+	for _, p := range patterns {
+		c, ok := imagePatterns.compiled[p]
+		if !ok {
+			c = &countedPattern{pattern: CompileImagePattern(p)}
+			imagePatterns.compiled[p] = c
+		}
+		c.refs++
+	}
+}
+
+// ReleaseImagePatterns releases patterns compiled by CompileImagePatterns, e.g. when
+// the policy they're in is updated or deleted
+func ReleaseImagePatterns(patterns []string) {
+	imagePatterns.Lock()
+	defer imagePatterns.Unlock()
+	for _, p := range patterns {
+		c, ok := imagePatterns.compiled[p]
+		if !ok {
+			continue
+		}
+		if c.refs--; c.refs <= 0 {
+			delete(imagePatterns.compiled, p)
+		}
+	}
+}
+
+// ImagePattern is a compiled whitelist pattern, see MatchImage
+type ImagePattern struct {
+	// glob is set if the pattern has a *
+	glob *regexp.Regexp
+	// ref is the normalized pattern, and tagged whether it has a tag or digest
+	ref    string
+	tagged bool
+}
+
+// CompileImagePattern compiles a whitelist pattern
+func CompileImagePattern(pattern string) *ImagePattern {
+	if strings.Contains(pattern, "*") {
+		return &ImagePattern{glob: globRegexp(normalizeGlob(pattern))}
+	}
+	if hasTagOrDigest(pattern) {
+		return &ImagePattern{ref: normalize(pattern), tagged: true}
+	}
+	return &ImagePattern{ref: repository(pattern)}
+}
+
+// Match reports whether image matches the pattern
+func (p *ImagePattern) Match(image string) bool {
+	if p.glob != nil {
+		// Globs whose registry is a glob can't be normalized, so are also matched against the image as is
+		return p.glob.MatchString(normalize(image)) || p.glob.MatchString(image)
+	}
+	if p.tagged {
+		return p.ref == normalize(image)
+	}
+	return p.ref == repository(image)
+}
+
+// globRegexp translates a whitelist glob into an anchored regular expression
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '*' {
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		if i+1 < len(pattern) && pattern[i+1] == '*' {
+			b.WriteString(".*")
+			i++
+			continue
+		}
+		b.WriteString("[^/]*")
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// normalizeGlob adds the default registry and library namespace to a glob, as the
+// reference parser does for images, unless its registry is a glob itself
+func normalizeGlob(pattern string) string {
+	i := strings.Index(pattern, "/")
+	if i != -1 && strings.Contains(pattern[:i], "*") {
+		return pattern
+	}
+	registry, path := name.DefaultRegistry, pattern
+	if i != -1 && (strings.ContainsAny(pattern[:i], ".:") || pattern[:i] == "localhost") {
+		registry, path = pattern[:i], pattern[i+1:]
+		if registry == "docker.io" {
+			registry = name.DefaultRegistry
+		}
+	}
+	if registry == name.DefaultRegistry && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	return registry + "/" + path
+}
+
+// hasTagOrDigest returns true if the last path component of ref has a tag or digest
+func hasTagOrDigest(ref string) bool {
+	return strings.ContainsAny(ref[strings.LastIndex(ref, "/")+1:], ":@")
+}
+
+// splitReference splits ref into its repository, and its tag or digest along with their separator
+func splitReference(ref string) (string, string) {
+	if i := strings.Index(ref, "@"); i != -1 {
+		return ref[:i], ref[i:]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i:]
+	}
+	return ref, ""
+}
+
+// normalize returns ref with its canonical repository, keeping its tag or digest
+func normalize(ref string) string {
+	_, suffix := splitReference(ref)
+	return repository(ref) + suffix
+}
+
+// repository strips the tag and digest from ref and returns its canonical repository
+func repository(ref string) string {
+	ref, _ = splitReference(ref)
+	repo, err := name.NewRepository(ref, name.WeakValidation)
+	if err != nil {
+		return ref
+	}
+	return repo.String()
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+const testDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+func TestMatchImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		image    string
+		expected bool
+	}{
+		{"exact digest", "gcr.io/proj/app@" + testDigest, "gcr.io/proj/app@" + testDigest, true},
+		{"other digest", "gcr.io/proj/app@sha256:1111", "gcr.io/proj/app@" + testDigest, false},
+		{"exact tag", "gcr.io/proj/app:v1", "gcr.io/proj/app:v1", true},
+		{"other tag", "gcr.io/proj/app:v1", "gcr.io/proj/app:v2", false},
+		{"repository matches digest", "gcr.io/proj/app", "gcr.io/proj/app@" + testDigest, true},
+		{"repository matches tag", "gcr.io/proj/app", "gcr.io/proj/app:v1", true},
+		{"repository matches bare image", "gcr.io/proj/app", "gcr.io/proj/app", true},
+		{"repository is not a prefix", "gcr.io/proj/app", "gcr.io/proj/app-two:v1", false},
+		{"repository does not match subpath", "gcr.io/proj/app", "gcr.io/proj/app/sub:v1", false},
+		{"repository with registry port", "localhost:5000/app", "localhost:5000/app:v1", true},
+		{"repository is normalized", "index.docker.io/library/nginx", "nginx:1.15", true},
+		{"star matches one segment", "gcr.io/proj/*", "gcr.io/proj/app@" + testDigest, true},
+		{"star matches tag", "gcr.io/proj/*", "gcr.io/proj/app:v1", true},
+		{"star does not cross segments", "gcr.io/proj/*", "gcr.io/proj/team/app:v1", false},
+		{"double star crosses segments", "gcr.io/proj/**", "gcr.io/proj/team/app:v1", true},
+		{"double star with any digest", "gcr.io/proj/**@sha256:*", "gcr.io/proj/team/app@" + testDigest, true},
+		{"double star with any digest rejects tags", "gcr.io/proj/**@sha256:*", "gcr.io/proj/team/app:v1", false},
+		{"glob in tag", "gcr.io/proj/app:v1.*", "gcr.io/proj/app:v1.2", true},
+		{"glob is anchored", "gcr.io/proj/*", "evil.io/gcr.io/proj/app", false},
+		{"glob dots are literal", "gcr.io/proj/*", "gcrxio/proj/app", false},
+		{"docker hub alias", "docker.io/library/nginx", "nginx", true},
+		{"exact tag is normalized", "docker.io/library/nginx:1.15", "nginx:1.15", true},
+		{"image is normalized", "nginx:1.15", "index.docker.io/library/nginx:1.15", true},
+		{"exact tag is normalized, other tag", "docker.io/library/nginx:1.15", "nginx:1.16", false},
+		{"glob is normalized", "docker.io/library/*", "nginx:1.15", true},
+		{"short glob is normalized", "ngin*", "docker.io/library/nginx:1.15", true},
+		{"glob in registry", "*.gcr.io/proj/*", "eu.gcr.io/proj/app:v1", true},
+		{"double star matches any image", "**", "nginx", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := MatchImage(test.pattern, test.image); actual != test.expected {
+				t.Errorf("MatchImage(%q, %q) = %v, expected %v", test.pattern, test.image, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestCompileImagePatterns(t *testing.T) {
+	compiled := func(pattern string) *ImagePattern {
+		imagePatterns.RLock()
+		defer imagePatterns.RUnlock()
+		if c, ok := imagePatterns.compiled[pattern]; ok {
+			return c.pattern
+		}
+		return nil
+	}
+	pattern := "gcr.io/compiled/*"
+	CompileImagePatterns([]string{pattern})
+	p := compiled(pattern)
+	if p == nil {
+		t.Fatalf("%s wasn't compiled", pattern)
+	}
+	// A second policy with the same pattern shares it
+	CompileImagePatterns([]string{pattern})
+	if compiled(pattern) != p {
+		t.Errorf("%s was compiled again", pattern)
+	}
+	if !MatchImage(pattern, "gcr.io/compiled/app:v1") {
+		t.Errorf("compiled %s doesn't match", pattern)
+	}
+	ReleaseImagePatterns([]string{pattern})
+	if compiled(pattern) == nil {
+		t.Errorf("%s was evicted while a policy still has it", pattern)
+	}
+	ReleaseImagePatterns([]string{pattern})
+	if compiled(pattern) != nil {
+		t.Errorf("%s wasn't evicted once no policy has it", pattern)
+	}
+	if !MatchImage(pattern, "gcr.io/compiled/app:v1") {
+		t.Errorf("evicted %s doesn't match", pattern)
+	}
+}
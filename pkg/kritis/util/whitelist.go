@@ -17,10 +17,6 @@ limitations under the License.
 package util
 
 import (
-	"reflect"
-
-	"github.com/golang/glog"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/grafeas/kritis/pkg/kritis/constants"
 )
 
@@ -28,31 +24,29 @@ import (
 func RemoveGloballyWhitelistedImages(images []string) []string {
 	notWhitelisted := []string{}
 	for _, image := range images {
-		whitelisted, err := imageInWhitelist(image)
-		if err != nil {
-			glog.Errorf("couldn't check if %s is in global whitelist: %v", image, err)
-		}
-		if !whitelisted {
+		if !imageInWhitelist(image) {
 			notWhitelisted = append(notWhitelisted, image)
 		}
 	}
 	return notWhitelisted
 }
 
-func imageInWhitelist(image string) (bool, error) {
-	for _, w := range constants.GlobalImageWhitelist {
-		whitelistRef, err := name.ParseReference(w, name.WeakValidation)
-		if err != nil {
-			return false, err
-		}
-		imageRef, err := name.ParseReference(image, name.WeakValidation)
-		if err != nil {
-			return false, err
-		}
-		// Make sure images have the same context
-		if reflect.DeepEqual(whitelistRef.Context(), imageRef.Context()) {
-			return true, nil
+// globalWhitelist is the compiled global image whitelist
+var globalWhitelist = compileImagePatterns(constants.GlobalImageWhitelist)
+
+func imageInWhitelist(image string) bool {
+	for _, w := range globalWhitelist {
+		if w.Match(image) {
+			return true
 		}
 	}
-	return false, nil
+	return false
+}
+
+func compileImagePatterns(patterns []string) []*ImagePattern {
+	compiled := make([]*ImagePattern, 0, len(patterns))
+	for _, p := range patterns {
+		compiled = append(compiled, CompileImagePattern(p))
+	}
+	return compiled
 }
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package violation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
+	kubernetesutil "github.com/grafeas/kritis/pkg/kritis/kubernetes"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxEventMessage bounds the message of an event, as the API server rejects longer ones
+const maxEventMessage = 1024
+
+// Event is the reason and message of an event about violations of the same type
+type Event struct {
+	Reason  string
+	Message string
+}
+
+// Events groups violations by type, in the order they are first found, and
+// returns an event for each type. The reason of an event is the violation type.
+func Events(violations []securitypolicy.SecurityPolicyViolation) []Event {
+	var events []Event
+	reasons := map[string][]string{}
+	for _, v := range violations {
+		t := securitypolicy.ViolationType(v.Violation)
+		if _, ok := reasons[t]; !ok {
+			events = append(events, Event{Reason: t})
+		}
+		reasons[t] = append(reasons[t], string(v.Reason))
+	}
+	for i, e := range events {
+		msg := strings.Join(reasons[e.Reason], "; ")
+		if len(msg) > maxEventMessage {
+			msg = msg[:maxEventMessage-3] + "..."
+		}
+		events[i].Message = msg
+	}
+	return events
+}
+
+// EventStrategy records a warning event per violation type against the pod,
+// and against the workload controlling it if any. Identical events are recorded
+// once and counted, so flagging the same pod at every cron cycle doesn't pile them up.
+type EventStrategy struct {
+	// RecordEvent records an event, it's kubernetes.RecordEvent if nil
+	RecordEvent func(ref v1.ObjectReference, eventType, reason, message string) error
+}
+
+func (e *EventStrategy) HandleViolation(image string, pod *v1.Pod, violations []securitypolicy.SecurityPolicyViolation) error {
+	record := e.RecordEvent
+	if record == nil {
+		record = kubernetesutil.RecordEvent
+	}
+	refs := []v1.ObjectReference{{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		refs = append(refs, OwnerReference(pod.Namespace, *owner))
+	}
+	for _, event := range Events(violations) {
+		for _, ref := range refs {
+			if err := record(ref, v1.EventTypeWarning, event.Reason, event.Message); err != nil {
+				return fmt.Errorf("error recording %s event for %s %s/%s: %v", event.Reason, ref.Kind, ref.Namespace, ref.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// OwnerReference returns a reference to the owner of an object in namespace
+func OwnerReference(namespace string, owner metav1.OwnerReference) v1.ObjectReference {
+	return v1.ObjectReference{
+		Kind:       owner.Kind,
+		APIVersion: owner.APIVersion,
+		Namespace:  namespace,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
+
+// Strategies handles violations with each of its strategies, in order
+type Strategies []Strategy
+
+func (s Strategies) HandleViolation(image string, pod *v1.Pod, violations []securitypolicy.SecurityPolicyViolation) error {
+	var errs []string
+	for _, strategy := range s {
+		if err := strategy.HandleViolation(image, pod, violations); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
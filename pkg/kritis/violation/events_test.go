@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package violation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafeas/kritis/pkg/kritis/crd/securitypolicy"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventStrategy(t *testing.T) {
+	isController := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", APIVersion: "apps/v1", Name: "rs", Controller: &isController},
+			},
+		},
+	}
+	violations := []securitypolicy.SecurityPolicyViolation{
+		{Violation: securitypolicy.ExceedsMaxSeverityViolation, Reason: "found CVE-1"},
+		{Violation: securitypolicy.FixesNotAvailableViolation, Reason: "found CVE-2"},
+		{Violation: securitypolicy.ExceedsMaxSeverityViolation, Reason: "found CVE-3"},
+	}
+	type event struct {
+		kind, reason, message string
+	}
+	var events []event
+	s := &EventStrategy{
+		RecordEvent: func(ref v1.ObjectReference, eventType, reason, message string) error {
+			if eventType != v1.EventTypeWarning || ref.Namespace != "ns" {
+				t.Errorf("got %s event in namespace %s, expected a warning in ns", eventType, ref.Namespace)
+			}
+			events = append(events, event{ref.Kind, reason, message})
+			return nil
+		},
+	}
+	if err := s.HandleViolation("image", pod, violations); err != nil {
+		t.Fatalf("HandleViolation() error = %v", err)
+	}
+	expected := []event{
+		{"Pod", "ExceedsMaxSeverity", "found CVE-1; found CVE-3"},
+		{"ReplicaSet", "ExceedsMaxSeverity", "found CVE-1; found CVE-3"},
+		{"Pod", "FixesNotAvailable", "found CVE-2"},
+		{"ReplicaSet", "FixesNotAvailable", "found CVE-2"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("got events %v, expected %v", events, expected)
+	}
+}